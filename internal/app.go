@@ -3,9 +3,21 @@
 package internal
 
 import (
+	"context"
+	"log"
+	"os"
+
 	"github.com/comame/note.comame.xyz/internal/server"
 )
 
 func RunApp() {
+	// ./server format-posts で、全ての記事を整形するバッチとして動く
+	if len(os.Args) > 1 && os.Args[1] == "format-posts" {
+		if err := server.FormatPosts(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	server.Start()
 }
@@ -5,6 +5,7 @@ package internal
 import (
 	"fmt"
 	"log"
+	"strings"
 	"syscall/js"
 
 	"github.com/comame/note.comame.xyz/internal/md"
@@ -12,6 +13,9 @@ import (
 
 func RunApp() {
 	js.Global().Set("go_parseMarkdown", js.FuncOf(parseMarkdown))
+	js.Global().Set("go_renderPreview", js.FuncOf(renderPreview))
+	js.Global().Set("go_lintMarkdown", js.FuncOf(lintMarkdown))
+	js.Global().Set("go_formatMarkdown", js.FuncOf(formatMarkdown))
 	log.Println("ready")
 
 	<-make(chan struct{})
@@ -27,7 +31,110 @@ func parseMarkdown(_ js.Value, args []js.Value) interface{} {
 	}()
 
 	markdown := args[0].String()
-	html := md.ToHTML(markdown)
+	// プレビューのスクロール位置を入力欄に合わせるため、元の行番号を出力する
+	html := md.ToHTMLWithOptions(markdown, md.Options{SourceLine: true})
 
 	return js.ValueOf(html)
 }
+
+// プレビューに表示するものを {html, sourceLineMap, diagnostics, stats} で返す。
+// sourceLineMap は行ごとのプレビューの要素の data-source-line 属性の値で、i 番目が i+1 行目に対応し、対応する要素が無い行は 0 になる。
+// diagnostics は md.Lint の結果を {line, column, severity, message} の配列にしたもの、stats は md.Stats の結果。
+// 入力のたびに呼ばれるので、文書は 1 回だけパースする。
+func renderPreview(_ js.Value, args []js.Value) interface{} {
+	defer func() {
+		if v := recover(); v != nil {
+			js.Global().Call("alert", js.ValueOf(fmt.Sprintf("%v", v)))
+			panic(v)
+		}
+	}()
+
+	markdown := args[0].String()
+
+	// JavaScript の文字列から作った文字列は、常に UTF-8 として正しい
+	doc, err := md.Parse(markdown)
+	if err != nil {
+		panic(err)
+	}
+
+	var html strings.Builder
+	if err := (md.HTMLRenderer{Options: md.Options{SourceLine: true}}).Render(&html, doc); err != nil {
+		panic(err)
+	}
+
+	var lineMap []interface{}
+	for _, l := range doc.SourceLineMap() {
+		lineMap = append(lineMap, l)
+	}
+
+	diagnostics := []interface{}{}
+	for _, d := range doc.Lint() {
+		diagnostics = append(diagnostics, map[string]interface{}{
+			"line":     d.Line,
+			"column":   d.Column,
+			"severity": d.Severity.String(),
+			"message":  d.Message,
+		})
+	}
+
+	stats := doc.Stats()
+
+	return js.ValueOf(map[string]interface{}{
+		"html":          html.String(),
+		"sourceLineMap": lineMap,
+		"diagnostics":   diagnostics,
+		"stats": map[string]interface{}{
+			"characters":     stats.Characters,
+			"codeBlocks":     stats.CodeBlocks,
+			"codeLines":      stats.CodeLines,
+			"images":         stats.Images,
+			"links":          stats.Links,
+			"readingMinutes": stats.ReadingMinutes,
+		},
+	})
+}
+
+// md.Lint の結果を {line, column, severity, message} の配列で返す
+func lintMarkdown(_ js.Value, args []js.Value) interface{} {
+	defer func() {
+		if v := recover(); v != nil {
+			js.Global().Call("alert", js.ValueOf(fmt.Sprintf("%v", v)))
+			panic(v)
+		}
+	}()
+
+	markdown := args[0].String()
+
+	ret := []interface{}{}
+	for _, d := range md.Lint(markdown) {
+		ret = append(ret, map[string]interface{}{
+			"line":     d.Line,
+			"column":   d.Column,
+			"severity": d.Severity.String(),
+			"message":  d.Message,
+		})
+	}
+
+	return js.ValueOf(ret)
+}
+
+// 整形した Markdown を返す
+func formatMarkdown(_ js.Value, args []js.Value) interface{} {
+	defer func() {
+		if v := recover(); v != nil {
+			js.Global().Call("alert", js.ValueOf(fmt.Sprintf("%v", v)))
+			panic(v)
+		}
+	}()
+
+	markdown := args[0].String()
+
+	// JavaScript の文字列から作った文字列は、常に UTF-8 として正しいので、
+	// 返るエラーは整形できずに元の書き方のまま残した部分があることだけを表す
+	formatted, err := md.Format(markdown)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return js.ValueOf(formatted)
+}
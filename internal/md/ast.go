@@ -0,0 +1,528 @@
+package md
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidUTF8 = errors.New("markdown is not valid UTF-8")
+
+// パース済みの Markdown 文書。
+// Children は書き換えてよく、Renderer は Children を出力する。
+// Lint, SourceLineMap, Stats, PlainText, Excerpt は Parse に渡した文書について、パースした時点の結果から求めるので、Children を書き換えても変わらない。
+type Document struct {
+	Children []*Node
+
+	// Parse に渡した文書の行と、パースした結果
+	lines    []string
+	elements []blockElement
+}
+
+// 元の文書での位置
+type Position struct {
+	// 開始行と終了行。1 から始まり、両端を含む
+	Line    int
+	EndLine int
+}
+
+type NodeKind int
+
+const (
+	// ブロック要素
+	NodeParagraph NodeKind = iota
+	NodeHeading
+	// リストの項目。入れ子のリストは Level で表し、項目を平坦に並べる
+	NodeListItem
+	NodeImage
+	NodeCodeBlock
+	NodeMathBlock
+	NodeDetails
+	NodeCallout
+	NodeBlockquote
+	NodeTable
+	NodeTableRow
+	NodeTableCell
+	NodeTOC
+	NodeFootnoteDefinition
+	// 空行。連続するリストを分割するために残している
+	NodeBlankLine
+
+	// インライン要素
+	NodeText
+	NodeStrong
+	NodeEmphasis
+	NodeCodeSpan
+	NodeLink
+	NodeStrikethrough
+	NodeMark
+	NodeFootnoteReference
+	NodeRuby
+	NodeMath
+	// 段落中の改行
+	NodeSoftBreak
+
+	// ここから下は後から追加した要素。既存の値を変えないよう、新しい要素は末尾に追加する。
+	// 行頭にタグがある行で、ブロック要素。許可されたタグと属性だけを出力する
+	NodeHTMLBlock
+	// HTML のタグで、インライン要素。許可されたタグと属性だけを出力する
+	NodeHTML
+)
+
+var nodeKindNames = map[NodeKind]string{
+	NodeParagraph:          "Paragraph",
+	NodeHeading:            "Heading",
+	NodeListItem:           "ListItem",
+	NodeImage:              "Image",
+	NodeCodeBlock:          "CodeBlock",
+	NodeMathBlock:          "MathBlock",
+	NodeDetails:            "Details",
+	NodeCallout:            "Callout",
+	NodeBlockquote:         "Blockquote",
+	NodeTable:              "Table",
+	NodeTableRow:           "TableRow",
+	NodeTableCell:          "TableCell",
+	NodeTOC:                "TOC",
+	NodeFootnoteDefinition: "FootnoteDefinition",
+	NodeBlankLine:          "BlankLine",
+	NodeText:               "Text",
+	NodeStrong:             "Strong",
+	NodeEmphasis:           "Emphasis",
+	NodeCodeSpan:           "CodeSpan",
+	NodeLink:               "Link",
+	NodeStrikethrough:      "Strikethrough",
+	NodeMark:               "Mark",
+	NodeFootnoteReference:  "FootnoteReference",
+	NodeRuby:               "Ruby",
+	NodeMath:               "Math",
+	NodeSoftBreak:          "SoftBreak",
+	NodeHTMLBlock:          "HTMLBlock",
+	NodeHTML:               "HTML",
+}
+
+func (k NodeKind) String() string {
+	if s, ok := nodeKindNames[k]; ok {
+		return s
+	}
+	return "Unknown"
+}
+
+// ブロック要素かどうか
+func (k NodeKind) IsBlock() bool {
+	return k < NodeText || k == NodeHTMLBlock
+}
+
+type Alignment int
+
+const (
+	AlignNone Alignment = iota
+	AlignLeft
+	AlignCenter
+	AlignRight
+)
+
+// 文書の要素。Kind によって使うフィールドが異なる。
+type Node struct {
+	Kind NodeKind
+	// インライン要素は、その要素がある行を持つ
+	Position Position
+	Children []*Node
+
+	// Text, CodeSpan, Math, CodeBlock, MathBlock の中身と、HTML, HTMLBlock の元の文字列
+	Literal string
+
+	// Heading は 1 から 6、ListItem は入れ子の深さ (1 から)
+	Level int
+	// Heading の id 属性
+	ID string
+
+	// ListItem
+	Ordered  bool
+	Start    int
+	Checkbox bool
+	Checked  bool
+
+	// Link の href と Image の src
+	Destination string
+	// Image のキャプション、Details の summary、Callout のタイトル
+	Title string
+
+	// CodeBlock
+	Language        string
+	FileName        string
+	HighlightLines  [][2]int
+	ShowLineNumbers bool
+
+	// Callout の種類 (note, tip, warning, alert)
+	CalloutKind string
+	// FootnoteDefinition と FootnoteReference の名前
+	Label string
+	// Ruby のルビ
+	Ruby string
+
+	// Table の各列の揃え方
+	Align []Alignment
+	// TableRow が見出し行かどうか
+	Header bool
+}
+
+// Markdown をパースする
+func Parse(md string) (*Document, error) {
+	if !utf8.ValidString(md) {
+		return nil, ErrInvalidUTF8
+	}
+
+	return parseDocument(md), nil
+}
+
+func parseDocument(md string) *Document {
+	lines := strings.Split(md, "\n")
+	elements := parseBlockLines(lines, 1)
+	assignHeadingIDs(elements)
+
+	return &Document{Children: blockElementsToNodes(elements), lines: lines, elements: elements}
+}
+
+// n とその子孫を深さ優先で訪問する。f が false を返したときは、その子は訪問しない。
+func Walk(n *Node, f func(n *Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range n.Children {
+		Walk(c, f)
+	}
+}
+
+// 文書中の全ての要素を深さ優先で訪問する
+func (d *Document) Walk(f func(n *Node) bool) {
+	for _, c := range d.Children {
+		Walk(c, f)
+	}
+}
+
+func blockElementsToNodes(elements []blockElement) []*Node {
+	var ret []*Node
+	for _, e := range elements {
+		ret = append(ret, blockElementToNode(e))
+	}
+	return ret
+}
+
+func blockElementToNode(e blockElement) *Node {
+	n := &Node{
+		Position: Position{Line: e.line, EndLine: e.endLine},
+	}
+
+	switch e.kind {
+	case blockElementKindParagraph:
+		n.Kind = NodeParagraph
+		// 段落の子は 1 行ごとのルートになっているので、改行を挟んで平坦にする
+		for i, line := range e.children.children {
+			if i > 0 {
+				n.Children = append(n.Children, &Node{Kind: NodeSoftBreak, Position: Position{Line: e.line + i - 1, EndLine: e.line + i - 1}})
+			}
+			n.Children = append(n.Children, inlineElementToNodes(line, e.line+i)...)
+		}
+		return n
+	case blockElementKindList:
+		n.Kind = NodeListItem
+		n.Level = e.listLevel
+		n.Ordered = e.listOrdered
+		n.Start = e.listStart
+		n.Checkbox = e.checkboxList
+		n.Checked = e.checkboxIsChecked
+	case blockElementKindImage:
+		n.Kind = NodeImage
+		n.Destination = e.imageSrc
+		n.Title = e.imageCaption
+	case blockElementKindCodeBlock:
+		n.Kind = NodeCodeBlock
+		n.Literal = e.codeText
+		n.Language = e.codeInfo.language
+		n.FileName = e.codeInfo.fileName
+		n.HighlightLines = e.codeInfo.highlightLines
+		n.ShowLineNumbers = e.codeInfo.showLineNumbers
+	case blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+		blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6:
+		n.Kind = NodeHeading
+		n.Level = headingLevel(e.kind)
+		n.ID = e.headingID
+	case blockElementKindEmpty:
+		n.Kind = NodeBlankLine
+	case blockElementDetails:
+		n.Kind = NodeDetails
+		n.Title = e.detailsSummary
+	case blockElementKindTable:
+		n.Kind = NodeTable
+		for _, a := range e.tableAlignments {
+			n.Align = append(n.Align, Alignment(a))
+		}
+		n.Children = append(n.Children, tableRowToNode(e.tableHeader, true, e.line))
+		for i, row := range e.tableRows {
+			// 2 行目は区切り行
+			n.Children = append(n.Children, tableRowToNode(row, false, e.line+i+2))
+		}
+		return n
+	case blockElementKindBlockquote:
+		n.Kind = NodeBlockquote
+	case blockElementKindTOC:
+		n.Kind = NodeTOC
+	case blockElementKindFootnoteDefinition:
+		n.Kind = NodeFootnoteDefinition
+		n.Label = e.footnoteLabel
+	case blockElementKindCallout:
+		n.Kind = NodeCallout
+		n.CalloutKind = e.calloutKind
+		n.Title = e.calloutTitle
+	case blockElementKindMath:
+		n.Kind = NodeMathBlock
+		n.Literal = e.mathText
+	case blockElementKindHTML:
+		n.Kind = NodeHTMLBlock
+		n.Literal = e.rawHTML
+	default:
+		panic("invalid blockElementKind")
+	}
+
+	n.Children = append(n.Children, inlineElementToNodes(e.children, e.line)...)
+	n.Children = append(n.Children, blockElementsToNodes(e.blocks)...)
+
+	return n
+}
+
+func tableRowToNode(cells []inlineElement, header bool, line int) *Node {
+	pos := Position{Line: line, EndLine: line}
+	row := &Node{Kind: NodeTableRow, Position: pos, Header: header}
+	for _, c := range cells {
+		row.Children = append(row.Children, &Node{
+			Kind:     NodeTableCell,
+			Position: pos,
+			Children: inlineElementToNodes(c, line),
+		})
+	}
+	return row
+}
+
+// インライン要素を Node に変換する。ルートは子を展開して返す。
+func inlineElementToNodes(e inlineElement, line int) []*Node {
+	if e.kind == inlineElementKindRoot {
+		var ret []*Node
+		for _, c := range e.children {
+			ret = append(ret, inlineElementToNodes(c, line)...)
+		}
+		return ret
+	}
+
+	n := &Node{Position: Position{Line: line, EndLine: line}}
+
+	switch e.kind {
+	case inlineElementKindText:
+		n.Kind = NodeText
+		n.Literal = e.s
+	case inlineElementKindBold:
+		n.Kind = NodeStrong
+	case inlineElementKindItalic:
+		n.Kind = NodeEmphasis
+	case inlineElementKindStrikethrough:
+		n.Kind = NodeStrikethrough
+	case inlineElementKindMark:
+		n.Kind = NodeMark
+	case inlineElementKindCode:
+		n.Kind = NodeCodeSpan
+		n.Literal = inlineElementToText(e)
+		return []*Node{n}
+	case inlineElementKindLink:
+		n.Kind = NodeLink
+		n.Destination = e.linkHref
+	case inlineElementKindFootnoteReference:
+		n.Kind = NodeFootnoteReference
+		n.Label = e.footnoteLabel
+	case inlineElementKindRuby:
+		n.Kind = NodeRuby
+		n.Ruby = e.rubyText
+	case inlineElementKindMath:
+		n.Kind = NodeMath
+		n.Literal = e.s
+	case inlineElementKindHTML:
+		n.Kind = NodeHTML
+		n.Literal = e.s
+	default:
+		panic("unknown inlineElementKind")
+	}
+
+	for _, c := range e.children {
+		n.Children = append(n.Children, inlineElementToNodes(c, line)...)
+	}
+
+	return []*Node{n}
+}
+
+// Node を HTML の出力に使う内部の表現に戻す
+func nodesToBlockElements(nodes []*Node) []blockElement {
+	var ret []blockElement
+	for _, n := range nodes {
+		ret = append(ret, nodeToBlockElement(n))
+	}
+	return ret
+}
+
+var headingKinds = []blockElementKind{
+	blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+	blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6,
+}
+
+func nodeToBlockElement(n *Node) blockElement {
+	e := blockElement{
+		line:     n.Position.Line,
+		endLine:  n.Position.EndLine,
+		children: inlineElement{kind: inlineElementKindRoot},
+	}
+
+	switch n.Kind {
+	case NodeParagraph:
+		e.kind = blockElementKindParagraph
+		// 改行ごとに 1 行分のルートを作る
+		line := inlineElement{kind: inlineElementKindRoot}
+		for _, c := range n.Children {
+			if c.Kind == NodeSoftBreak {
+				e.children.children = append(e.children.children, line)
+				line = inlineElement{kind: inlineElementKindRoot}
+				continue
+			}
+			line.children = append(line.children, nodeToInlineElement(c))
+		}
+		e.children.children = append(e.children.children, line)
+		return e
+	case NodeHeading:
+		level := min(max(n.Level, 1), 6)
+		e.kind = headingKinds[level-1]
+		e.headingID = n.ID
+	case NodeListItem:
+		e.kind = blockElementKindList
+		e.listLevel = max(n.Level, 1)
+		e.listOrdered = n.Ordered
+		e.listStart = n.Start
+		e.checkboxList = n.Checkbox
+		e.checkboxIsChecked = n.Checked
+	case NodeImage:
+		e.kind = blockElementKindImage
+		e.imageSrc = n.Destination
+		e.imageCaption = n.Title
+	case NodeCodeBlock:
+		e.kind = blockElementKindCodeBlock
+		e.codeText = n.Literal
+		e.codeInfo = codeBlockInfo{
+			language:        n.Language,
+			fileName:        n.FileName,
+			highlightLines:  n.HighlightLines,
+			showLineNumbers: n.ShowLineNumbers,
+		}
+	case NodeMathBlock:
+		e.kind = blockElementKindMath
+		e.mathText = n.Literal
+	case NodeHTMLBlock:
+		e.kind = blockElementKindHTML
+		e.rawHTML = n.Literal
+	case NodeDetails:
+		e.kind = blockElementDetails
+		e.detailsSummary = n.Title
+	case NodeCallout:
+		e.kind = blockElementKindCallout
+		e.calloutKind = n.CalloutKind
+		e.calloutTitle = n.Title
+	case NodeBlockquote:
+		e.kind = blockElementKindBlockquote
+	case NodeTable:
+		e.kind = blockElementKindTable
+		for _, a := range n.Align {
+			e.tableAlignments = append(e.tableAlignments, tableAlignment(a))
+		}
+		for _, row := range n.Children {
+			var cells []inlineElement
+			for _, cell := range row.Children {
+				cells = append(cells, nodesToInlineRoot(cell.Children))
+			}
+			if row.Header {
+				e.tableHeader = cells
+			} else {
+				e.tableRows = append(e.tableRows, cells)
+			}
+		}
+		return e
+	case NodeTOC:
+		e.kind = blockElementKindTOC
+	case NodeFootnoteDefinition:
+		e.kind = blockElementKindFootnoteDefinition
+		e.footnoteLabel = n.Label
+	case NodeBlankLine:
+		e.kind = blockElementKindEmpty
+	default:
+		panic("not a block node: " + n.Kind.String())
+	}
+
+	for _, c := range n.Children {
+		if c.Kind.IsBlock() {
+			e.blocks = append(e.blocks, nodeToBlockElement(c))
+		} else {
+			e.children.children = append(e.children.children, nodeToInlineElement(c))
+		}
+	}
+
+	return e
+}
+
+func nodesToInlineRoot(nodes []*Node) inlineElement {
+	root := inlineElement{kind: inlineElementKindRoot}
+	for _, c := range nodes {
+		root.children = append(root.children, nodeToInlineElement(c))
+	}
+	return root
+}
+
+func nodeToInlineElement(n *Node) inlineElement {
+	var e inlineElement
+
+	switch n.Kind {
+	case NodeText:
+		e.kind = inlineElementKindText
+		e.s = n.Literal
+	case NodeStrong:
+		e.kind = inlineElementKindBold
+	case NodeEmphasis:
+		e.kind = inlineElementKindItalic
+	case NodeStrikethrough:
+		e.kind = inlineElementKindStrikethrough
+	case NodeMark:
+		e.kind = inlineElementKindMark
+	case NodeCodeSpan:
+		e.kind = inlineElementKindCode
+		e.children = []inlineElement{{kind: inlineElementKindText, s: n.Literal}}
+		return e
+	case NodeLink:
+		e.kind = inlineElementKindLink
+		e.linkHref = n.Destination
+	case NodeFootnoteReference:
+		e.kind = inlineElementKindFootnoteReference
+		e.footnoteLabel = n.Label
+	case NodeRuby:
+		e.kind = inlineElementKindRuby
+		e.rubyText = n.Ruby
+	case NodeMath:
+		e.kind = inlineElementKindMath
+		e.s = n.Literal
+	case NodeHTML:
+		e.kind = inlineElementKindHTML
+		e.s = n.Literal
+	case NodeSoftBreak:
+		// 段落以外では改行を区別しない
+		e.kind = inlineElementKindText
+	default:
+		panic("not an inline node: " + n.Kind.String())
+	}
+
+	for _, c := range n.Children {
+		e.children = append(e.children, nodeToInlineElement(c))
+	}
+
+	return e
+}
@@ -0,0 +1,165 @@
+package md
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+const astTestDocument = `[[toc]]
+# Title
+line1 **bold** [link](https://example.com)
+line2 *em* ~~del~~ ==mark== ` + "`code`" + ` $x^2$ {漢字|かんじ}[^1]
+
+- [x] done
+  1. one
+  2. two
+
+![caption](https://example.com/a.png)
+
+` + "```go:main.go {1} showLineNumbers" + `
+package main
+` + "```" + `
+
+$$
+\frac{1}{2}
+$$
+
+| a | b |
+|:--|--:|
+| [c](https://example.com/c) | d |
+
+> quote
+> > nested
+
+:::details summary
+## Inner
+:::
+
+:::warning 注意
+text[^1]
+:::
+
+[^1]: footnote`
+
+func TestHTMLRenderer(t *testing.T) {
+	d, err := Parse(astTestDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (HTMLRenderer{}).Render(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	test.AssertSame(t, buf.String(), ToHTML(astTestDocument))
+}
+
+func TestNodeKind(t *testing.T) {
+	// 公開している値は変えない
+	test.AssertEquals(t, NodeBlankLine, NodeKind(14))
+	test.AssertEquals(t, NodeSoftBreak, NodeKind(25))
+
+	test.AssertEquals(t, NodeHTMLBlock.IsBlock(), true)
+	test.AssertEquals(t, NodeHTML.IsBlock(), false)
+	test.AssertEquals(t, NodeHTML.String(), "HTML")
+}
+
+func TestDocumentMethods(t *testing.T) {
+	d, err := Parse(astTestDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertSame(t, d.PlainText(), PlainText(astTestDocument))
+	test.AssertSame(t, d.Excerpt(20), Excerpt(astTestDocument, 20))
+	test.AssertEquals(t, d.Stats(), Stats(astTestDocument))
+	test.AssertEquals(t, d.SourceLineMap(), SourceLineMap(astTestDocument))
+	test.AssertEquals(t, d.Lint(), Lint(astTestDocument))
+
+	// Children を書き換えると出力は変わるが、元の文書についての情報は変わらない
+	d.Children = d.Children[:1]
+	var buf bytes.Buffer
+	if err := (HTMLRenderer{}).Render(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	test.AssertSame(t, buf.String(), ToHTML(strings.SplitN(astTestDocument, "\n", 2)[0]))
+	test.AssertSame(t, d.PlainText(), PlainText(astTestDocument))
+	test.AssertEquals(t, d.Stats(), Stats(astTestDocument))
+	test.AssertEquals(t, d.Lint(), Lint(astTestDocument))
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	d, err := Parse("- [ ] todo\n\n![画像](https://example.com/a.png)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// チェックボックスと画像の URL を書き換える
+	d.Walk(func(n *Node) bool {
+		switch n.Kind {
+		case NodeListItem:
+			n.Checked = true
+		case NodeImage:
+			n.Destination = "https://example.com/b.png"
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := (MarkdownRenderer{}).Render(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	test.AssertSame(t, buf.String(), "- [x] todo\n\n![画像](https://example.com/b.png)\n")
+
+	// Parse し直すと画像にならない URL は書き表せない
+	d.Walk(func(n *Node) bool {
+		if n.Kind == NodeImage {
+			n.Destination = "http://example.com/b.png"
+		}
+		return true
+	})
+	buf.Reset()
+	test.AssertEquals(t, (MarkdownRenderer{}).Render(&buf, d), ErrNotRepresentable)
+	test.AssertSame(t, buf.String(), "")
+}
+
+func TestParse(t *testing.T) {
+	d, err := Parse("# Title\nline1 [a](https://a.example)\nline2\n\n> [b](https://b.example)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEquals(t, len(d.Children), 4)
+	test.AssertEquals(t, d.Children[0].Kind, NodeHeading)
+	test.AssertEquals(t, d.Children[0].Level, 1)
+	test.AssertSame(t, d.Children[0].ID, "title")
+	test.AssertEquals(t, d.Children[1].Kind, NodeParagraph)
+	test.AssertEquals(t, d.Children[1].Position, Position{Line: 2, EndLine: 3})
+
+	var links []*Node
+	d.Walk(func(n *Node) bool {
+		if n.Kind == NodeLink {
+			links = append(links, n)
+		}
+		return true
+	})
+	test.AssertEquals(t, len(links), 2)
+	test.AssertSame(t, links[0].Destination, "https://a.example")
+	test.AssertEquals(t, links[0].Position, Position{Line: 2, EndLine: 2})
+	test.AssertSame(t, links[1].Destination, "https://b.example")
+	test.AssertEquals(t, links[1].Position, Position{Line: 5, EndLine: 5})
+
+	// false を返すと子孫を訪問しない
+	count := 0
+	d.Walk(func(n *Node) bool {
+		count++
+		return n.Kind != NodeBlockquote
+	})
+	test.AssertEquals(t, count, 10)
+
+	_, err = Parse("\xff")
+	test.AssertEquals(t, err, ErrInvalidUTF8)
+}
@@ -0,0 +1,145 @@
+package md
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 記法をひととおり含む記事を、size バイト以上になるまで繰り返す
+func benchmarkDocument(size int) string {
+	section := `## 見出し
+
+本文の **強調** と *斜体* と ~~打ち消し~~ と ==マーカー== と ` + "`code`" + ` と $x^2$ と {漢字|かんじ}。
+[リンク](https://example.com) を含む 2 行目の文章[^1]。
+
+- list
+  - nested
+- [x] checkbox
+1. ordered
+2. ordered
+
+> 引用
+> > 入れ子の引用
+
+:::note メモ
+コールアウトの中身
+:::
+
+| a | b |
+|:--|--:|
+| 1 | 2 |
+
+` + "```go {1}" + `
+func main() {
+	fmt.Println("hello")
+}
+` + "```" + `
+
+$$
+\frac{1}{2}
+$$
+
+![caption](https://example.com/image.png)
+
+[^1]: 脚注
+
+`
+
+	var b strings.Builder
+	for b.Len() < size {
+		b.WriteString(section)
+	}
+	return b.String()
+}
+
+// 文書の大きさに対して処理時間が線形であることを、サイズごとの MB/s が一定であることで確認する
+func BenchmarkToHTML(b *testing.B) {
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20} {
+		doc := benchmarkDocument(size)
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			b.ReportAllocs()
+			for range b.N {
+				ToHTML(doc)
+			}
+		})
+	}
+}
+
+// 閉じられていない強調が 1 行に大量にあるときも、行の長さに対して線形であることを確認する
+func BenchmarkToHTMLLongLine(b *testing.B) {
+	for _, size := range []int{16 << 10, 64 << 10, 256 << 10} {
+		doc := strings.Repeat("a * b ", size/6)
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			for range b.N {
+				ToHTML(doc)
+			}
+		})
+	}
+}
+
+// 閉じられていない [ や < などが 1 行に大量にあるときも、ToHTML, Lint, Format が行の長さに対して線形であることを確認する
+func BenchmarkUnclosedOpener(b *testing.B) {
+	funcs := []struct {
+		name string
+		f    func(string)
+	}{
+		{"ToHTML", func(s string) { ToHTML(s) }},
+		{"Lint", func(s string) { Lint(s) }},
+		{"Format", func(s string) { Format(s) }},
+	}
+	openers := []struct {
+		name, s string
+	}{
+		{"bracket", "["},
+		{"angle", "<"},
+		{"brace", "{"},
+		{"footnote", "[^"},
+		{"ruby", "｜"},
+	}
+	for _, f := range funcs {
+		for _, o := range openers {
+			for _, size := range []int{16 << 10, 64 << 10} {
+				doc := strings.Repeat(o.s+"a ", size/(len(o.s)+2))
+				b.Run(fmt.Sprintf("%s/%s/%dKB", f.name, o.name, size>>10), func(b *testing.B) {
+					b.SetBytes(int64(len(doc)))
+					for range b.N {
+						f.f(doc)
+					}
+				})
+			}
+		}
+	}
+}
+
+// :::note や <details> が深く入れ子になっていても、ToHTML と Lint が文書の大きさに対して線形であることを確認する
+func BenchmarkNestedContainers(b *testing.B) {
+	funcs := []struct {
+		name string
+		f    func(string)
+	}{
+		{"ToHTML", func(s string) { ToHTML(s) }},
+		{"Lint", func(s string) { Lint(s) }},
+	}
+	containers := []struct {
+		name, start, end string
+	}{
+		{"note", ":::note\n", ":::\n"},
+		{"details", "<details>\n", "</details>\n"},
+	}
+	for _, f := range funcs {
+		for _, c := range containers {
+			for _, depth := range []int{500, 2000} {
+				doc := strings.Repeat(c.start, depth) + "text\n" + strings.Repeat(c.end, depth)
+				b.Run(fmt.Sprintf("%s/%s/%d", f.name, c.name, depth), func(b *testing.B) {
+					b.SetBytes(int64(len(doc)))
+					for range b.N {
+						f.f(doc)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,796 @@
+package md
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options.CommonMark のときに使う、CommonMark (https://spec.commonmark.org/0.31.2/) に従うパーサー。
+// 通常のパーサーとは要素の構造が異なるので、独自の木を作る。脚注や数式などの拡張は解釈しない。
+// ブロック構造の解析は、仕様の付録にある 2 段階の方式 (ブロック構造を作ってからインライン要素を解釈する) に従う。
+
+type cmNodeKind int
+
+const (
+	cmDocument cmNodeKind = iota
+	cmBlockQuote
+	cmList
+	cmItem
+	cmParagraph
+	cmHeading
+	cmThematicBreak
+	cmCodeBlock
+	cmHTMLBlock
+
+	cmText
+	cmSoftBreak
+	cmLineBreak
+	cmEmphasis
+	cmStrong
+	cmCode
+	cmLink
+	cmImage
+	cmHTMLInline
+)
+
+// 子要素を連結リストで持つ。強調の解釈では、子要素の付け替えを頻繁に行うため
+type cmNode struct {
+	kind                                      cmNodeKind
+	parent, firstChild, lastChild, prev, next *cmNode
+
+	// ブロック要素の、元の文書での開始行と終了行
+	line, endLine int
+	open          bool
+	// インライン要素として解釈する前の、ブロック要素の中身。行ごとに追加するので []byte で持つ
+	content []byte
+	// テキストやコードなどの中身
+	literal string
+
+	// 見出しの階層
+	level int
+	list  cmListData
+
+	fenced      bool
+	fenceChar   byte
+	fenceLength int
+	// 開始のフェンスのインデント。中身の行から同じだけ空白を取り除く
+	fenceOffset int
+	info        string
+
+	// HTML ブロックの種類。仕様の 1 から 7 の番号に対応する
+	htmlBlockType int
+
+	destination, title string
+}
+
+type cmListData struct {
+	ordered    bool
+	bulletChar byte
+	start      int
+	delimiter  byte
+	tight      bool
+	// 行頭からリストの記号までの幅と、記号から中身までの幅
+	markerOffset, padding int
+}
+
+func (n *cmNode) appendChild(child *cmNode) {
+	child.unlink()
+	child.parent = n
+	if n.lastChild != nil {
+		n.lastChild.next = child
+		child.prev = n.lastChild
+	} else {
+		n.firstChild = child
+	}
+	n.lastChild = child
+}
+
+func (n *cmNode) insertAfter(sibling *cmNode) {
+	sibling.unlink()
+	sibling.next = n.next
+	if sibling.next != nil {
+		sibling.next.prev = sibling
+	}
+	sibling.prev = n
+	n.next = sibling
+	sibling.parent = n.parent
+	if sibling.next == nil && sibling.parent != nil {
+		sibling.parent.lastChild = sibling
+	}
+}
+
+func (n *cmNode) unlink() {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else if n.parent != nil {
+		n.parent.firstChild = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else if n.parent != nil {
+		n.parent.lastChild = n.prev
+	}
+	n.parent, n.prev, n.next = nil, nil, nil
+}
+
+// 行のインデントとして扱う空白の幅。これ以上はインデントされたコードブロックになる
+const cmCodeIndent = 4
+
+var (
+	cmLineEndingPattern     = regexp.MustCompile(`\r\n|\n|\r`)
+	cmMaybeSpecialPattern   = regexp.MustCompile(`^[#` + "`" + `~*+_=<>0-9-]`)
+	cmATXHeadingPattern     = regexp.MustCompile(`^#{1,6}(?:[ \t]+|$)`)
+	cmATXClosingPattern     = regexp.MustCompile(`(?:^|[ \t]+)#+[ \t]*$`)
+	cmSetextHeadingPattern  = regexp.MustCompile(`^(?:=+|-+)[ \t]*$`)
+	cmOrderedListPattern    = regexp.MustCompile(`^(\d{1,9})([.)])`)
+	cmHTMLBlockOpenPatterns = []*regexp.Regexp{
+		nil,
+		regexp.MustCompile(`(?i)^<(?:script|pre|textarea|style)(?:\s|>|$)`),
+		regexp.MustCompile(`^<!--`),
+		regexp.MustCompile(`^<[?]`),
+		regexp.MustCompile(`^<![A-Za-z]`),
+		regexp.MustCompile(`^<!\[CDATA\[`),
+		regexp.MustCompile(`(?i)^</?(?:address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[123456]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul)(?:\s|/?>|$)`),
+		regexp.MustCompile(`(?i)^(?:` + cmOpenTag + `|` + cmCloseTag + `)\s*$`),
+	}
+	cmHTMLBlockClosePatterns = []*regexp.Regexp{
+		nil,
+		regexp.MustCompile(`(?i)</(?:script|pre|textarea|style)>`),
+		regexp.MustCompile(`-->`),
+		regexp.MustCompile(`\?>`),
+		regexp.MustCompile(`>`),
+		regexp.MustCompile(`\]\]>`),
+	}
+	cmHTMLBlockTrailingBlankPattern = regexp.MustCompile(`(?:\n *)+$`)
+)
+
+type cmParser struct {
+	doc, tip, oldTip *cmNode
+	// 今回の行で、開いているブロックのうち継続していると確認できた最も深いもの
+	lastMatchedContainer *cmNode
+	allClosed            bool
+
+	line       string
+	lineNumber int
+	// 行内の位置 (バイト) と、タブを展開したときの列
+	offset, column int
+	// 次の空白でない文字の位置と列、そこまでのインデントの幅
+	nextNonspace, nextNonspaceColumn, indent int
+	indented, blank                          bool
+	// タブの途中までを読み進めたか。残りは空白として中身に加える
+	partiallyConsumedTab bool
+	// この位置から行末までが、1 種類の記号と空白だけからなる。
+	// リストの記号が続く行で、入れ子ごとに行末まで照合し直さないよう、行ごとに 1 回だけ求める
+	thematicBreakFrom int
+
+	inline cmInlineParser
+}
+
+type cmReference struct {
+	destination, title string
+}
+
+func parseCommonMark(src string) *cmNode {
+	p := &cmParser{
+		doc:    &cmNode{kind: cmDocument, open: true, line: 1},
+		inline: cmInlineParser{references: make(map[string]cmReference)},
+	}
+	p.tip = p.doc
+
+	lines := cmLineEndingPattern.Split(src, -1)
+	// 末尾の改行の後ろは行として扱わない
+	n := len(lines)
+	if strings.HasSuffix(src, "\n") || strings.HasSuffix(src, "\r") {
+		n--
+	}
+	for _, l := range lines[:n] {
+		p.incorporateLine(l)
+	}
+	for p.tip != nil {
+		p.finalize(p.tip, n)
+	}
+
+	p.processInlines(p.doc)
+	return p.doc
+}
+
+func (p *cmParser) peek(i int) int {
+	if i < len(p.line) {
+		return int(p.line[i])
+	}
+	return -1
+}
+
+func cmIsSpaceOrTab(c int) bool {
+	return c == ' ' || c == '\t'
+}
+
+func (p *cmParser) findNextNonspace() {
+	i, cols := p.offset, p.column
+	for i < len(p.line) {
+		if p.line[i] == ' ' {
+			i++
+			cols++
+		} else if p.line[i] == '\t' {
+			i++
+			cols += 4 - cols%4
+		} else {
+			break
+		}
+	}
+	p.blank = i == len(p.line)
+	p.nextNonspace = i
+	p.nextNonspaceColumn = cols
+	p.indent = cols - p.column
+	p.indented = p.indent >= cmCodeIndent
+}
+
+func (p *cmParser) advanceNextNonspace() {
+	p.offset = p.nextNonspace
+	p.column = p.nextNonspaceColumn
+	p.partiallyConsumedTab = false
+}
+
+// count 文字、または columns が true のときは count 列だけ読み進める。
+// 列で数えるときは、タブの途中で止まることがある
+func (p *cmParser) advanceOffset(count int, columns bool) {
+	for count > 0 && p.offset < len(p.line) {
+		if p.line[p.offset] != '\t' {
+			p.partiallyConsumedTab = false
+			p.offset++
+			p.column++
+			count--
+			continue
+		}
+
+		charsToTab := 4 - p.column%4
+		if !columns {
+			p.partiallyConsumedTab = false
+			p.column += charsToTab
+			p.offset++
+			count--
+			continue
+		}
+		p.partiallyConsumedTab = charsToTab > count
+		advance := min(charsToTab, count)
+		p.column += advance
+		if !p.partiallyConsumedTab {
+			p.offset++
+		}
+		count -= advance
+	}
+}
+
+func (p *cmParser) addLine() {
+	if p.partiallyConsumedTab {
+		p.offset++
+		p.tip.content = append(p.tip.content, strings.Repeat(" ", 4-p.column%4)...)
+	}
+	p.tip.content = append(append(p.tip.content, p.line[p.offset:]...), '\n')
+}
+
+func (p *cmParser) addChild(kind cmNodeKind) *cmNode {
+	for !cmCanContain(p.tip.kind, kind) {
+		p.finalize(p.tip, p.lineNumber-1)
+	}
+	n := &cmNode{kind: kind, open: true, line: p.lineNumber}
+	p.tip.appendChild(n)
+	p.tip = n
+	return n
+}
+
+func cmCanContain(parent, child cmNodeKind) bool {
+	switch parent {
+	case cmDocument, cmBlockQuote, cmItem:
+		return child != cmItem
+	case cmList:
+		return child == cmItem
+	}
+	return false
+}
+
+func cmAcceptsLines(kind cmNodeKind) bool {
+	return kind == cmParagraph || kind == cmCodeBlock || kind == cmHTMLBlock
+}
+
+func (p *cmParser) closeUnmatchedBlocks() {
+	if p.allClosed {
+		return
+	}
+	for p.oldTip != p.lastMatchedContainer {
+		parent := p.oldTip.parent
+		p.finalize(p.oldTip, p.lineNumber-1)
+		p.oldTip = parent
+	}
+	p.allClosed = true
+}
+
+func (p *cmParser) incorporateLine(line string) {
+	container := p.doc
+	p.oldTip = p.tip
+	p.offset, p.column = 0, 0
+	p.blank = false
+	p.partiallyConsumedTab = false
+	p.lineNumber++
+	p.line = strings.ReplaceAll(line, "\x00", "\uFFFD")
+	p.thematicBreakFrom = cmThematicBreakSuffix(p.line)
+
+	// 開いているブロックについて、この行でも継続するかを外側から順に確かめる
+	for container.lastChild != nil && container.lastChild.open {
+		container = container.lastChild
+		p.findNextNonspace()
+		matched := p.continueBlock(container)
+		if matched == cmBlockLineConsumed {
+			return
+		}
+		if matched == cmBlockNotMatched {
+			container = container.parent
+			break
+		}
+	}
+
+	p.allClosed = container == p.oldTip
+	p.lastMatchedContainer = container
+
+	// 新しいブロックの開始を探す
+	matchedLeaf := container.kind != cmParagraph && cmAcceptsLines(container.kind)
+	for !matchedLeaf {
+		p.findNextNonspace()
+		if !p.indented && !cmMaybeSpecialPattern.MatchString(p.line[p.nextNonspace:]) {
+			p.advanceNextNonspace()
+			break
+		}
+
+		started := cmBlockNotStarted
+		for _, start := range cmBlockStarts {
+			if started = start(p, container); started != cmBlockNotStarted {
+				break
+			}
+		}
+		if started == cmBlockNotStarted {
+			p.advanceNextNonspace()
+			break
+		}
+		container = p.tip
+		if started == cmBlockStartedLeaf {
+			matchedLeaf = true
+		}
+	}
+
+	// 残りは段落の続きか、新しいブロックの中身
+	if !p.allClosed && !p.blank && p.tip.kind == cmParagraph {
+		// 遅延継続行
+		p.addLine()
+		return
+	}
+
+	p.closeUnmatchedBlocks()
+	switch {
+	case cmAcceptsLines(container.kind):
+		p.addLine()
+		if t := container.htmlBlockType; container.kind == cmHTMLBlock && 1 <= t && t <= 5 && cmHTMLBlockClosePatterns[t].MatchString(p.line[p.offset:]) {
+			p.finalize(container, p.lineNumber)
+		}
+	case p.offset < len(p.line) && !p.blank:
+		p.addChild(cmParagraph)
+		p.advanceNextNonspace()
+		p.addLine()
+	}
+}
+
+// continueBlock の結果
+const (
+	cmBlockMatched = iota
+	cmBlockNotMatched
+	// 閉じのフェンスなど、行全体を使い切った
+	cmBlockLineConsumed
+)
+
+func (p *cmParser) continueBlock(n *cmNode) int {
+	switch n.kind {
+	case cmBlockQuote:
+		if p.indented || p.peek(p.nextNonspace) != '>' {
+			return cmBlockNotMatched
+		}
+		p.advanceNextNonspace()
+		p.advanceOffset(1, false)
+		if cmIsSpaceOrTab(p.peek(p.offset)) {
+			p.advanceOffset(1, true)
+		}
+	case cmItem:
+		if p.blank {
+			// 空の項目の後の空行で、項目は終わる
+			if n.firstChild == nil {
+				return cmBlockNotMatched
+			}
+			p.advanceNextNonspace()
+		} else if p.indent >= n.list.markerOffset+n.list.padding {
+			p.advanceOffset(n.list.markerOffset+n.list.padding, true)
+		} else {
+			return cmBlockNotMatched
+		}
+	case cmHeading, cmThematicBreak:
+		return cmBlockNotMatched
+	case cmCodeBlock:
+		if n.fenced {
+			if p.indent <= 3 && p.peek(p.nextNonspace) == int(n.fenceChar) && cmClosingFenceLength(p.line[p.nextNonspace:]) >= n.fenceLength {
+				p.finalize(n, p.lineNumber)
+				return cmBlockLineConsumed
+			}
+			for i := n.fenceOffset; i > 0 && cmIsSpaceOrTab(p.peek(p.offset)); i-- {
+				p.advanceOffset(1, true)
+			}
+		} else if p.indent >= cmCodeIndent {
+			p.advanceOffset(cmCodeIndent, true)
+		} else if p.blank {
+			p.advanceNextNonspace()
+		} else {
+			return cmBlockNotMatched
+		}
+	case cmHTMLBlock:
+		if p.blank && (n.htmlBlockType == 6 || n.htmlBlockType == 7) {
+			return cmBlockNotMatched
+		}
+	case cmParagraph:
+		if p.blank {
+			return cmBlockNotMatched
+		}
+	}
+	return cmBlockMatched
+}
+
+// 閉じのフェンスとして使える、行頭の ``` または ~~~ の長さ。閉じのフェンスでなければ 0
+func cmClosingFenceLength(s string) int {
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 || strings.Trim(s[n:], " \t") != "" {
+		return 0
+	}
+	return n
+}
+
+// 行末から見て、*、-、_ のいずれか 1 種類と空白だけが続く部分の開始位置
+func cmThematicBreakSuffix(line string) int {
+	var marker byte
+	i := len(line)
+	for ; i > 0; i-- {
+		c := line[i-1]
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		if c != '*' && c != '-' && c != '_' || marker != 0 && c != marker {
+			break
+		}
+		marker = c
+	}
+	return i
+}
+
+// 開始のフェンスの文字と長さ。``` の後ろの情報文字列には ` を含められない
+func cmOpeningFence(s string) (byte, int) {
+	if s == "" || (s[0] != '`' && s[0] != '~') {
+		return 0, 0
+	}
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 || (s[0] == '`' && strings.Contains(s[n:], "`")) {
+		return 0, 0
+	}
+	return s[0], n
+}
+
+// ブロックの開始を試す関数の結果
+const (
+	cmBlockNotStarted = iota
+	// コンテナが始まった。続けて中身のブロックの開始を試す
+	cmBlockStartedContainer
+	// 中身を持たないブロックが始まった。行の残りはそのブロックの中身
+	cmBlockStartedLeaf
+)
+
+// 仕様の優先順位の順に試す
+var cmBlockStarts = []func(p *cmParser, container *cmNode) int{
+	(*cmParser).startBlockQuote,
+	(*cmParser).startATXHeading,
+	(*cmParser).startFencedCodeBlock,
+	(*cmParser).startHTMLBlock,
+	(*cmParser).startSetextHeading,
+	(*cmParser).startThematicBreak,
+	(*cmParser).startListItem,
+	(*cmParser).startIndentedCodeBlock,
+}
+
+func (p *cmParser) startBlockQuote(_ *cmNode) int {
+	if p.indented || p.peek(p.nextNonspace) != '>' {
+		return cmBlockNotStarted
+	}
+	p.advanceNextNonspace()
+	p.advanceOffset(1, false)
+	if cmIsSpaceOrTab(p.peek(p.offset)) {
+		p.advanceOffset(1, true)
+	}
+	p.closeUnmatchedBlocks()
+	p.addChild(cmBlockQuote)
+	return cmBlockStartedContainer
+}
+
+func (p *cmParser) startATXHeading(_ *cmNode) int {
+	if p.indented {
+		return cmBlockNotStarted
+	}
+	m := cmATXHeadingPattern.FindString(p.line[p.nextNonspace:])
+	if m == "" {
+		return cmBlockNotStarted
+	}
+	p.advanceNextNonspace()
+	p.advanceOffset(len(m), false)
+	p.closeUnmatchedBlocks()
+
+	n := p.addChild(cmHeading)
+	n.level = len(strings.TrimRight(m, " \t"))
+	n.content = []byte(cmATXClosingPattern.ReplaceAllString(p.line[p.offset:], ""))
+	p.advanceOffset(len(p.line)-p.offset, false)
+	return cmBlockStartedLeaf
+}
+
+func (p *cmParser) startFencedCodeBlock(_ *cmNode) int {
+	if p.indented {
+		return cmBlockNotStarted
+	}
+	c, length := cmOpeningFence(p.line[p.nextNonspace:])
+	if length == 0 {
+		return cmBlockNotStarted
+	}
+	p.closeUnmatchedBlocks()
+
+	n := p.addChild(cmCodeBlock)
+	n.fenced = true
+	n.fenceChar = c
+	n.fenceLength = length
+	n.fenceOffset = p.indent
+	p.advanceNextNonspace()
+	p.advanceOffset(length, false)
+	return cmBlockStartedLeaf
+}
+
+func (p *cmParser) startHTMLBlock(container *cmNode) int {
+	if p.indented || p.peek(p.nextNonspace) != '<' {
+		return cmBlockNotStarted
+	}
+	s := p.line[p.nextNonspace:]
+	for t := 1; t <= 7; t++ {
+		if !cmHTMLBlockOpenPatterns[t].MatchString(s) {
+			continue
+		}
+		// 7 番目の種類は段落を中断できない
+		lazy := !p.allClosed && !p.blank && p.tip.kind == cmParagraph
+		if t == 7 && (container.kind == cmParagraph || lazy) {
+			continue
+		}
+		p.closeUnmatchedBlocks()
+		n := p.addChild(cmHTMLBlock)
+		n.htmlBlockType = t
+		return cmBlockStartedLeaf
+	}
+	return cmBlockNotStarted
+}
+
+func (p *cmParser) startSetextHeading(container *cmNode) int {
+	if p.indented || container.kind != cmParagraph {
+		return cmBlockNotStarted
+	}
+	m := cmSetextHeadingPattern.FindString(p.line[p.nextNonspace:])
+	if m == "" {
+		return cmBlockNotStarted
+	}
+	p.closeUnmatchedBlocks()
+
+	// 段落の先頭のリンク参照定義は見出しに含めない
+	p.parseReferences(container)
+	if len(container.content) == 0 {
+		return cmBlockNotStarted
+	}
+
+	heading := &cmNode{kind: cmHeading, open: true, line: container.line, content: container.content}
+	heading.level = 2
+	if m[0] == '=' {
+		heading.level = 1
+	}
+	container.insertAfter(heading)
+	container.unlink()
+	p.tip = heading
+	p.advanceOffset(len(p.line)-p.offset, false)
+	return cmBlockStartedLeaf
+}
+
+func (p *cmParser) startThematicBreak(_ *cmNode) int {
+	if p.indented || p.nextNonspace < p.thematicBreakFrom || p.blank {
+		return cmBlockNotStarted
+	}
+	if strings.Count(p.line[p.nextNonspace:], p.line[p.nextNonspace:p.nextNonspace+1]) < 3 {
+		return cmBlockNotStarted
+	}
+	p.closeUnmatchedBlocks()
+	p.addChild(cmThematicBreak)
+	p.advanceOffset(len(p.line)-p.offset, false)
+	return cmBlockStartedLeaf
+}
+
+func (p *cmParser) startListItem(container *cmNode) int {
+	if p.indented && container.kind != cmList {
+		return cmBlockNotStarted
+	}
+	data, ok := p.parseListMarker(container)
+	if !ok {
+		return cmBlockNotStarted
+	}
+	p.closeUnmatchedBlocks()
+
+	if p.tip.kind != cmList || !cmListsMatch(container.list, data) {
+		list := p.addChild(cmList)
+		list.list = data
+	}
+	item := p.addChild(cmItem)
+	item.list = data
+	return cmBlockStartedContainer
+}
+
+func cmListsMatch(a, b cmListData) bool {
+	return a.ordered == b.ordered && a.delimiter == b.delimiter && a.bulletChar == b.bulletChar
+}
+
+// リストの記号を読み、中身の開始位置まで読み進める
+func (p *cmParser) parseListMarker(container *cmNode) (cmListData, bool) {
+	data := cmListData{tight: true, markerOffset: p.indent}
+	if p.indent >= cmCodeIndent {
+		return data, false
+	}
+
+	rest := p.line[p.nextNonspace:]
+	var markerLength int
+	if rest != "" && (rest[0] == '*' || rest[0] == '+' || rest[0] == '-') {
+		data.bulletChar = rest[0]
+		markerLength = 1
+	} else if m := cmOrderedListPattern.FindStringSubmatch(rest); m != nil && (container.kind != cmParagraph || m[1] == "1") {
+		data.ordered = true
+		data.start, _ = strconv.Atoi(m[1])
+		data.delimiter = m[2][0]
+		markerLength = len(m[0])
+	} else {
+		return data, false
+	}
+
+	// 記号の後ろには空白か行末が必要
+	if c := p.peek(p.nextNonspace + markerLength); c != -1 && !cmIsSpaceOrTab(c) {
+		return data, false
+	}
+	// 段落を中断するときは、空の項目にできない
+	if container.kind == cmParagraph && strings.Trim(p.line[p.nextNonspace+markerLength:], " \t") == "" {
+		return data, false
+	}
+
+	p.advanceNextNonspace()
+	p.advanceOffset(markerLength, true)
+	spacesStartColumn, spacesStartOffset := p.column, p.offset
+	for {
+		p.advanceOffset(1, true)
+		if p.column-spacesStartColumn >= 5 || !cmIsSpaceOrTab(p.peek(p.offset)) {
+			break
+		}
+	}
+	blankItem := p.peek(p.offset) == -1
+	spacesAfterMarker := p.column - spacesStartColumn
+	// 記号の後ろの空白が 5 つ以上なら、中身はインデントされたコードブロックなので、空白 1 つだけを記号の一部とする
+	if spacesAfterMarker >= 5 || spacesAfterMarker < 1 || blankItem {
+		data.padding = markerLength + 1
+		p.column, p.offset = spacesStartColumn, spacesStartOffset
+		if cmIsSpaceOrTab(p.peek(p.offset)) {
+			p.advanceOffset(1, true)
+		}
+	} else {
+		data.padding = markerLength + spacesAfterMarker
+	}
+	return data, true
+}
+
+func (p *cmParser) startIndentedCodeBlock(_ *cmNode) int {
+	if !p.indented || p.tip.kind == cmParagraph || p.blank {
+		return cmBlockNotStarted
+	}
+	p.advanceOffset(cmCodeIndent, true)
+	p.closeUnmatchedBlocks()
+	p.addChild(cmCodeBlock)
+	return cmBlockStartedLeaf
+}
+
+// ブロックを閉じる。endLine はブロックの最後の行
+func (p *cmParser) finalize(n *cmNode, endLine int) {
+	above := n.parent
+	n.open = false
+	n.endLine = endLine
+
+	switch n.kind {
+	case cmParagraph:
+		if p.parseReferences(n) && strings.Trim(string(n.content), " \t\n") == "" {
+			n.unlink()
+		}
+	case cmCodeBlock:
+		if n.fenced {
+			// 最初の行は情報文字列
+			info, rest, _ := strings.Cut(string(n.content), "\n")
+			n.info = cmUnescapeString(strings.Trim(info, " \t"))
+			n.literal = rest
+			break
+		}
+		lines := strings.Split(string(n.content), "\n")
+		for len(lines) > 0 && strings.Trim(lines[len(lines)-1], " \t") == "" {
+			lines = lines[:len(lines)-1]
+		}
+		n.literal = strings.Join(lines, "\n") + "\n"
+		n.endLine = n.line + len(lines) - 1
+	case cmHTMLBlock:
+		n.literal = cmHTMLBlockTrailingBlankPattern.ReplaceAllString(string(n.content), "")
+	case cmList:
+		n.endLine = n.lastChild.endLine
+		n.list.tight = cmIsTightList(n)
+	case cmItem:
+		if n.lastChild != nil {
+			n.endLine = n.lastChild.endLine
+		} else {
+			n.endLine = n.line
+		}
+	}
+	p.tip = above
+}
+
+// 段落の先頭のリンク参照定義を読み、中身から取り除く。定義があれば true を返す
+func (p *cmParser) parseReferences(n *cmNode) bool {
+	content := string(n.content)
+	found := false
+	for strings.HasPrefix(content, "[") {
+		l := p.inline.parseReference(content)
+		if l == 0 {
+			break
+		}
+		content = content[l:]
+		found = true
+	}
+	if found {
+		n.content = []byte(content)
+	}
+	return found
+}
+
+// 項目の間や、項目の中のブロックの間に空行があれば、ゆるいリストになる
+func cmIsTightList(list *cmNode) bool {
+	for item := list.firstChild; item != nil; item = item.next {
+		if item.next != nil && cmEndsWithBlankLine(item) {
+			return false
+		}
+		for sub := item.firstChild; sub != nil; sub = sub.next {
+			if cmEndsWithBlankLine(sub) && (item.next != nil || sub.next != nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 次の兄弟との間に空行があるか
+func cmEndsWithBlankLine(n *cmNode) bool {
+	return n.next != nil && n.endLine != n.next.line-1
+}
+
+func (p *cmParser) processInlines(n *cmNode) {
+	for c := n.firstChild; c != nil; c = c.next {
+		p.processInlines(c)
+	}
+	if n.kind == cmParagraph || n.kind == cmHeading {
+		p.inline.parse(n)
+	}
+}
@@ -0,0 +1,213 @@
+package md
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CommonMark の仕様の例と同じ形式で出力する。ブロック要素のタグの前後には改行を入れる
+type cmHTMLWriter struct {
+	w *htmlWriter
+	// 最後に書き込んだ文字。改行が続かないようにするために使う
+	last byte
+	// 画像の alt の中ではタグを出力しない
+	disableTags int
+	// 生の HTML と URL を検証せずに出力する。仕様の例と比べるときだけ使う
+	rawHTML bool
+	// HTML のブロックと、段落などの中の HTML のタグ。閉じられていないタグは、それぞれの範囲の終わりで閉じる
+	blockHTML, inlineHTML *htmlSanitizer
+}
+
+var cmEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+func writeCommonMarkHTML(w *htmlWriter, doc *cmNode, rawHTML bool) {
+	cw := &cmHTMLWriter{w: w, last: '\n', rawHTML: rawHTML}
+	cw.node(doc)
+}
+
+// htmlSanitizer から書き込めるようにする
+func (cw *cmHTMLWriter) WriteString(s string) (int, error) {
+	cw.lit(s)
+	return len(s), nil
+}
+
+func (cw *cmHTMLWriter) lit(s string) {
+	if s == "" {
+		return
+	}
+	cw.w.WriteString(s)
+	cw.last = s[len(s)-1]
+}
+
+func (cw *cmHTMLWriter) tag(s string) {
+	if cw.disableTags > 0 {
+		return
+	}
+	cw.lit(s)
+}
+
+func (cw *cmHTMLWriter) cr() {
+	if cw.last != '\n' {
+		cw.lit("\n")
+	}
+}
+
+func (cw *cmHTMLWriter) sourceLineAttr(n *cmNode) string {
+	if !cw.w.options.SourceLine {
+		return ""
+	}
+	return " data-source-line=\"" + strconv.Itoa(n.line) + "\""
+}
+
+func (cw *cmHTMLWriter) children(n *cmNode) {
+	for c := n.firstChild; c != nil; c = c.next {
+		cw.node(c)
+	}
+}
+
+// 子要素の中で開かれたまま閉じられていない HTML のタグを、子要素の後で閉じる
+func (cw *cmHTMLWriter) scopedChildren(z **htmlSanitizer, n *cmNode) {
+	outer := *z
+	*z = &htmlSanitizer{}
+	cw.children(n)
+	(*z).close(cw)
+	*z = outer
+}
+
+// 生の HTML を出力する。alt の中では出力しない
+func (cw *cmHTMLWriter) html(z *htmlSanitizer, s string) {
+	if cw.rawHTML {
+		cw.lit(s)
+		return
+	}
+	if cw.disableTags == 0 {
+		z.write(cw, s)
+	}
+}
+
+func (cw *cmHTMLWriter) url(s string) string {
+	if !cw.rawHTML && !isSafeURL(s) {
+		return ""
+	}
+	return cmEscaper.Replace(s)
+}
+
+func (cw *cmHTMLWriter) node(n *cmNode) {
+	switch n.kind {
+	case cmDocument:
+		cw.scopedChildren(&cw.blockHTML, n)
+	case cmParagraph:
+		// 詰まったリストの項目では、段落を p で囲まない
+		if gp := n.parent.parent; gp != nil && gp.kind == cmList && gp.list.tight {
+			cw.scopedChildren(&cw.inlineHTML, n)
+			return
+		}
+		cw.cr()
+		cw.tag("<p" + cw.sourceLineAttr(n) + ">")
+		cw.scopedChildren(&cw.inlineHTML, n)
+		cw.tag("</p>")
+		cw.cr()
+	case cmHeading:
+		tag := "h" + strconv.Itoa(n.level)
+		cw.cr()
+		cw.tag("<" + tag + cw.sourceLineAttr(n) + ">")
+		cw.scopedChildren(&cw.inlineHTML, n)
+		cw.tag("</" + tag + ">")
+		cw.cr()
+	case cmThematicBreak:
+		cw.cr()
+		cw.tag("<hr" + cw.sourceLineAttr(n) + " />")
+		cw.cr()
+	case cmBlockQuote:
+		cw.cr()
+		cw.tag("<blockquote" + cw.sourceLineAttr(n) + ">")
+		cw.cr()
+		cw.scopedChildren(&cw.blockHTML, n)
+		cw.cr()
+		cw.tag("</blockquote>")
+		cw.cr()
+	case cmList:
+		tag, attr := "ul", ""
+		if n.list.ordered {
+			tag = "ol"
+			if n.list.start != 1 {
+				attr = " start=\"" + strconv.Itoa(n.list.start) + "\""
+			}
+		}
+		cw.cr()
+		cw.tag("<" + tag + attr + cw.sourceLineAttr(n) + ">")
+		cw.cr()
+		cw.children(n)
+		cw.cr()
+		cw.tag("</" + tag + ">")
+		cw.cr()
+	case cmItem:
+		cw.tag("<li" + cw.sourceLineAttr(n) + ">")
+		cw.scopedChildren(&cw.blockHTML, n)
+		cw.tag("</li>")
+		cw.cr()
+	case cmCodeBlock:
+		attr := ""
+		if words := strings.Fields(n.info); len(words) > 0 {
+			attr = " class=\"language-" + cmEscaper.Replace(words[0]) + "\""
+		}
+		cw.cr()
+		cw.tag("<pre" + cw.sourceLineAttr(n) + "><code" + attr + ">")
+		cw.lit(cmEscaper.Replace(n.literal))
+		cw.tag("</code></pre>")
+		cw.cr()
+	case cmHTMLBlock:
+		cw.cr()
+		cw.html(cw.blockHTML, n.literal)
+		cw.cr()
+	case cmText:
+		cw.lit(cmEscaper.Replace(n.literal))
+	case cmSoftBreak:
+		cw.lit("\n")
+	case cmLineBreak:
+		cw.tag("<br />")
+		cw.cr()
+	case cmEmphasis:
+		cw.tag("<em>")
+		cw.children(n)
+		cw.tag("</em>")
+	case cmStrong:
+		cw.tag("<strong>")
+		cw.children(n)
+		cw.tag("</strong>")
+	case cmCode:
+		cw.tag("<code>")
+		cw.lit(cmEscaper.Replace(n.literal))
+		cw.tag("</code>")
+	case cmLink:
+		// 安全でない URL は href を出力しない
+		attr := ""
+		if href := cw.url(n.destination); href != "" || n.destination == "" {
+			attr = " href=\"" + href + "\""
+		}
+		if n.title != "" {
+			attr += " title=\"" + cmEscaper.Replace(n.title) + "\""
+		}
+		cw.tag("<a" + attr + ">")
+		cw.children(n)
+		cw.tag("</a>")
+	case cmImage:
+		// alt には子要素の文字列だけを出力する
+		if cw.disableTags == 0 {
+			cw.lit("<img src=\"" + cw.url(n.destination) + "\" alt=\"")
+		}
+		cw.disableTags++
+		cw.children(n)
+		cw.disableTags--
+		if cw.disableTags == 0 {
+			if n.title != "" {
+				cw.lit("\" title=\"" + cmEscaper.Replace(n.title))
+			}
+			cw.lit("\" />")
+		}
+	case cmHTMLInline:
+		cw.html(cw.inlineHTML, n.literal)
+	default:
+		panic("unknown cmNodeKind")
+	}
+}
@@ -0,0 +1,812 @@
+package md
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CommonMark の HTML のタグ。HTML ブロックの開始と、インラインの生の HTML で使う
+const (
+	cmTagName        = `[A-Za-z][A-Za-z0-9-]*`
+	cmAttributeName  = `[a-zA-Z_:][a-zA-Z0-9_.:-]*`
+	cmAttributeValue = `(?:[^"'=<>` + "`" + `\x00-\x20]+|'[^']*'|"[^"]*")`
+	cmAttribute      = `(?:\s+` + cmAttributeName + `(?:\s*=\s*` + cmAttributeValue + `)?)`
+	cmOpenTag        = `<` + cmTagName + cmAttribute + `*\s*/?>`
+	cmCloseTag       = `</` + cmTagName + `\s*>`
+)
+
+var (
+	cmHTMLTagPattern               = regexp.MustCompile(`^(?:` + cmOpenTag + `|` + cmCloseTag + `|<!-->|<!--->|(?s:<!--.*?-->)|(?s:<\?.*?\?>)|<![A-Za-z][^>]*>|(?s:<!\[CDATA\[.*?\]\]>))`)
+	cmTextPattern                  = regexp.MustCompile("^[^\n`\\[\\]\\\\!<&*_]+")
+	cmEntityPattern                = regexp.MustCompile(`^&(?:#[xX][a-fA-F0-9]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	cmEmailAutolinkPattern         = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	cmAutolinkPattern              = regexp.MustCompile(`^<[A-Za-z][A-Za-z0-9.+-]{1,31}:[^<>\x00-\x20]*>`)
+	cmLinkDestinationBracesPattern = regexp.MustCompile(`^<(?:[^<>\n\\\x00]|\\.)*>`)
+	cmLinkTitlePattern             = regexp.MustCompile(`(?s)^(?:"(?:\\.|[^\\"\x00])*"|'(?:\\.|[^\\'\x00])*'|\((?:\\.|[^\\()\x00])*\))`)
+	cmEntityOrEscapedCharPattern   = regexp.MustCompile(`\\[!-/:-@\[-` + "`" + `{-~]|&(?:#[xX][a-fA-F0-9]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	cmReferenceWhitespacePattern   = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+type cmInlineParser struct {
+	subject string
+	pos     int
+	// 強調の区切り文字と、リンクの開始の [ のスタック
+	delimiters *cmDelimiter
+	brackets   *cmBracket
+	// リンクの中にリンクは置けないので、リンクができたらそれより前の [ は無効にする。
+	// スタックを辿らずに済むよう、無効になった範囲を subject での位置で持つ
+	inactiveLinkOpenersBefore int
+	// 正規化したラベルから、リンク参照定義へ
+	references map[string]cmReference
+	htmlTags   cmHTMLTagMatcher
+}
+
+// cmHTMLTagPattern は、コメントなどの閉じが無いと末尾まで走査してしまう。
+// 閉じが無ければそれより後ろのコメントなども閉じられないので、覚えておいて照合を省く。
+// 同じ文字列の、先頭から順に切り出した部分にだけ使う
+type cmHTMLTagMatcher struct {
+	// コメント、処理命令、CDATA、宣言の閉じが無い
+	unclosed [4]bool
+}
+
+var cmHTMLTagEnds = [4]string{"-->", "?>", "]]>", ">"}
+
+func (hm *cmHTMLTagMatcher) match(s string) string {
+	kind := -1
+	switch {
+	case strings.HasPrefix(s, "<!--"):
+		kind = 0
+	case strings.HasPrefix(s, "<?"):
+		kind = 1
+	case strings.HasPrefix(s, "<![CDATA["):
+		kind = 2
+	case len(s) > 2 && s[1] == '!' && ('A' <= s[2] && s[2] <= 'Z' || 'a' <= s[2] && s[2] <= 'z'):
+		kind = 3
+	}
+	if kind >= 0 && (hm.unclosed[kind] || !strings.Contains(s[2:], cmHTMLTagEnds[kind])) {
+		hm.unclosed[kind] = true
+		return ""
+	}
+	return cmHTMLTagPattern.FindString(s)
+}
+
+// * または _ の連続
+type cmDelimiter struct {
+	c byte
+	// 残りの数と、元の数
+	count, originalCount int
+	node                 *cmNode
+	previous, next       *cmDelimiter
+	canOpen, canClose    bool
+}
+
+// [ または ![
+type cmBracket struct {
+	node              *cmNode
+	previous          *cmBracket
+	previousDelimiter *cmDelimiter
+	// subject での [ の位置
+	index int
+	image bool
+	// 後ろに別の [ があるか
+	bracketAfter bool
+}
+
+func cmTextNode(s string) *cmNode {
+	return &cmNode{kind: cmText, literal: s}
+}
+
+func (ip *cmInlineParser) peek() int {
+	if ip.pos < len(ip.subject) {
+		return int(ip.subject[ip.pos])
+	}
+	return -1
+}
+
+// 段落や見出しの中身を、インライン要素として解釈して子要素にする
+func (ip *cmInlineParser) parse(block *cmNode) {
+	ip.subject = strings.Trim(string(block.content), " \t\n")
+	ip.pos = 0
+	ip.delimiters = nil
+	ip.brackets = nil
+	ip.inactiveLinkOpenersBefore = 0
+	for ip.parseInline(block) {
+	}
+	block.content = nil
+	ip.processEmphasis(nil)
+}
+
+func (ip *cmInlineParser) parseInline(block *cmNode) bool {
+	if ip.pos >= len(ip.subject) {
+		return false
+	}
+
+	c := ip.subject[ip.pos]
+	ok := false
+	switch c {
+	case '\n':
+		ok = ip.parseNewline(block)
+	case '\\':
+		ok = ip.parseBackslash(block)
+	case '`':
+		ok = ip.parseBackticks(block)
+	case '*', '_':
+		ok = ip.handleDelimiter(c, block)
+	case '[':
+		ok = ip.parseOpenBracket(block)
+	case '!':
+		ok = ip.parseBang(block)
+	case ']':
+		ok = ip.parseCloseBracket(block)
+	case '<':
+		ok = ip.parseAutolink(block) || ip.parseHTMLTag(block)
+	case '&':
+		ok = ip.parseEntity(block)
+	default:
+		ok = ip.parseString(block)
+	}
+	if !ok {
+		ip.pos++
+		block.appendChild(cmTextNode(string(c)))
+	}
+	return true
+}
+
+func (ip *cmInlineParser) parseString(block *cmNode) bool {
+	m := cmTextPattern.FindString(ip.subject[ip.pos:])
+	if m == "" {
+		return false
+	}
+	ip.pos += len(m)
+	block.appendChild(cmTextNode(m))
+	return true
+}
+
+// 行末に 2 つ以上の空白があれば改行、そうでなければ単なる改行文字として扱う
+func (ip *cmInlineParser) parseNewline(block *cmNode) bool {
+	ip.pos++
+	kind := cmSoftBreak
+	if last := block.lastChild; last != nil && last.kind == cmText && strings.HasSuffix(last.literal, " ") {
+		if strings.HasSuffix(last.literal, "  ") {
+			kind = cmLineBreak
+		}
+		last.literal = strings.TrimRight(last.literal, " ")
+	}
+	block.appendChild(&cmNode{kind: kind})
+
+	for ip.peek() == ' ' {
+		ip.pos++
+	}
+	return true
+}
+
+func cmIsASCIIPunctuation(c byte) bool {
+	return '!' <= c && c <= '/' || ':' <= c && c <= '@' || '[' <= c && c <= '`' || '{' <= c && c <= '~'
+}
+
+func (ip *cmInlineParser) parseBackslash(block *cmNode) bool {
+	ip.pos++
+	switch c := ip.peek(); {
+	case c == '\n':
+		ip.pos++
+		block.appendChild(&cmNode{kind: cmLineBreak})
+	case c != -1 && cmIsASCIIPunctuation(byte(c)):
+		ip.pos++
+		block.appendChild(cmTextNode(string(rune(c))))
+	default:
+		block.appendChild(cmTextNode("\\"))
+	}
+	return true
+}
+
+// 同じ長さの ` の連続で閉じられるまでをコードとする
+func (ip *cmInlineParser) parseBackticks(block *cmNode) bool {
+	start := ip.pos
+	for ip.peek() == '`' {
+		ip.pos++
+	}
+	ticks := ip.pos - start
+	afterOpenTicks := ip.pos
+
+	for {
+		i := strings.IndexByte(ip.subject[ip.pos:], '`')
+		if i < 0 {
+			break
+		}
+		closeStart := ip.pos + i
+		ip.pos = closeStart
+		for ip.peek() == '`' {
+			ip.pos++
+		}
+		if ip.pos-closeStart != ticks {
+			continue
+		}
+
+		contents := strings.ReplaceAll(ip.subject[afterOpenTicks:closeStart], "\n", " ")
+		// 両端の空白は 1 つだけ取り除く。空白だけのときは取り除かない
+		if len(contents) >= 2 && contents[0] == ' ' && contents[len(contents)-1] == ' ' && strings.Trim(contents, " ") != "" {
+			contents = contents[1 : len(contents)-1]
+		}
+		block.appendChild(&cmNode{kind: cmCode, literal: contents})
+		return true
+	}
+
+	ip.pos = afterOpenTicks
+	block.appendChild(cmTextNode(ip.subject[start:afterOpenTicks]))
+	return true
+}
+
+func cmIsUnicodeWhitespace(r rune) bool {
+	return unicode.Is(unicode.Zs, r) || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+}
+
+func cmIsUnicodePunctuation(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// 区切り文字の連続の数と、強調を開始または終了できるかを調べる
+func (ip *cmInlineParser) scanDelimiters(c byte) (count int, canOpen, canClose bool) {
+	start := ip.pos
+	for ip.pos+count < len(ip.subject) && ip.subject[ip.pos+count] == c {
+		count++
+	}
+
+	// 文書の先頭と末尾は改行として扱う
+	before, after := '\n', '\n'
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(ip.subject[:start])
+	}
+	if start+count < len(ip.subject) {
+		after, _ = utf8.DecodeRuneInString(ip.subject[start+count:])
+	}
+
+	afterIsWhitespace := cmIsUnicodeWhitespace(after)
+	afterIsPunctuation := cmIsUnicodePunctuation(after)
+	beforeIsWhitespace := cmIsUnicodeWhitespace(before)
+	beforeIsPunctuation := cmIsUnicodePunctuation(before)
+
+	leftFlanking := !afterIsWhitespace && (!afterIsPunctuation || beforeIsWhitespace || beforeIsPunctuation)
+	rightFlanking := !beforeIsWhitespace && (!beforeIsPunctuation || afterIsWhitespace || afterIsPunctuation)
+	if c == '_' {
+		canOpen = leftFlanking && (!rightFlanking || beforeIsPunctuation)
+		canClose = rightFlanking && (!leftFlanking || afterIsPunctuation)
+	} else {
+		canOpen = leftFlanking
+		canClose = rightFlanking
+	}
+	return count, canOpen, canClose
+}
+
+// 区切り文字はいったんテキストとして追加し、processEmphasis で強調に置き換える
+func (ip *cmInlineParser) handleDelimiter(c byte, block *cmNode) bool {
+	count, canOpen, canClose := ip.scanDelimiters(c)
+	node := cmTextNode(ip.subject[ip.pos : ip.pos+count])
+	ip.pos += count
+	block.appendChild(node)
+
+	if canOpen || canClose {
+		ip.delimiters = &cmDelimiter{
+			c:             c,
+			count:         count,
+			originalCount: count,
+			node:          node,
+			previous:      ip.delimiters,
+			canOpen:       canOpen,
+			canClose:      canClose,
+		}
+		if ip.delimiters.previous != nil {
+			ip.delimiters.previous.next = ip.delimiters
+		}
+	}
+	return true
+}
+
+func (ip *cmInlineParser) removeDelimiter(d *cmDelimiter) {
+	if d.previous != nil {
+		d.previous.next = d.next
+	}
+	if d.next != nil {
+		d.next.previous = d.previous
+	} else {
+		ip.delimiters = d.previous
+	}
+}
+
+// stackBottom より上の区切り文字を、対応する組から強調に置き換える
+func (ip *cmInlineParser) processEmphasis(stackBottom *cmDelimiter) {
+	// 対応する開始の区切り文字が見つからなかったときに、次の探索を打ち切る位置。
+	// 区切り文字の種類、開始もできるか、元の数を 3 で割った余りごとに持つ
+	var openersBottom [2][2][3]*cmDelimiter
+	for i := range openersBottom {
+		for j := range openersBottom[i] {
+			for k := range openersBottom[i][j] {
+				openersBottom[i][j][k] = stackBottom
+			}
+		}
+	}
+
+	closer := ip.delimiters
+	for closer != nil && closer.previous != stackBottom {
+		closer = closer.previous
+	}
+
+	for closer != nil {
+		if !closer.canClose {
+			closer = closer.next
+			continue
+		}
+
+		kindIndex, openIndex := 0, 0
+		if closer.c == '*' {
+			kindIndex = 1
+		}
+		if closer.canOpen {
+			openIndex = 1
+		}
+		bottom := &openersBottom[kindIndex][openIndex][closer.originalCount%3]
+
+		opener := closer.previous
+		found := false
+		for opener != nil && opener != stackBottom && opener != *bottom {
+			// 両方が開始と終了のどちらにもなれるとき、合計が 3 の倍数なら組にならない
+			oddMatch := (closer.canOpen || opener.canClose) && closer.originalCount%3 != 0 && (opener.originalCount+closer.originalCount)%3 == 0
+			if opener.c == closer.c && opener.canOpen && !oddMatch {
+				found = true
+				break
+			}
+			opener = opener.previous
+		}
+
+		oldCloser := closer
+		if !found {
+			closer = closer.next
+			*bottom = oldCloser.previous
+			if !oldCloser.canOpen {
+				ip.removeDelimiter(oldCloser)
+			}
+			continue
+		}
+
+		used := 1
+		if closer.count >= 2 && opener.count >= 2 {
+			used = 2
+		}
+		opener.count -= used
+		closer.count -= used
+		opener.node.literal = opener.node.literal[:len(opener.node.literal)-used]
+		closer.node.literal = closer.node.literal[:len(closer.node.literal)-used]
+
+		emphasis := &cmNode{kind: cmEmphasis}
+		if used == 2 {
+			emphasis.kind = cmStrong
+		}
+		for n := opener.node.next; n != nil && n != closer.node; {
+			next := n.next
+			emphasis.appendChild(n)
+			n = next
+		}
+		opener.node.insertAfter(emphasis)
+
+		// 組の間の区切り文字は、もう組にならない
+		if opener.next != closer {
+			opener.next = closer
+			closer.previous = opener
+		}
+		if opener.count == 0 {
+			opener.node.unlink()
+			ip.removeDelimiter(opener)
+		}
+		if closer.count == 0 {
+			closer.node.unlink()
+			next := closer.next
+			ip.removeDelimiter(closer)
+			closer = next
+		}
+	}
+
+	for ip.delimiters != nil && ip.delimiters != stackBottom {
+		ip.removeDelimiter(ip.delimiters)
+	}
+}
+
+func (ip *cmInlineParser) addBracket(node *cmNode, index int, image bool) {
+	if ip.brackets != nil {
+		ip.brackets.bracketAfter = true
+	}
+	ip.brackets = &cmBracket{
+		node:              node,
+		previous:          ip.brackets,
+		previousDelimiter: ip.delimiters,
+		index:             index,
+		image:             image,
+	}
+}
+
+func (ip *cmInlineParser) parseOpenBracket(block *cmNode) bool {
+	start := ip.pos
+	ip.pos++
+	node := cmTextNode("[")
+	block.appendChild(node)
+	ip.addBracket(node, start, false)
+	return true
+}
+
+func (ip *cmInlineParser) parseBang(block *cmNode) bool {
+	start := ip.pos
+	ip.pos++
+	if ip.peek() != '[' {
+		block.appendChild(cmTextNode("!"))
+		return true
+	}
+	ip.pos++
+	node := cmTextNode("![")
+	block.appendChild(node)
+	ip.addBracket(node, start+1, true)
+	return true
+}
+
+// 直前の [ と組になるリンクや画像を探す。見つからなければ ] はただの文字になる
+func (ip *cmInlineParser) parseCloseBracket(block *cmNode) bool {
+	ip.pos++
+	start := ip.pos
+
+	opener := ip.brackets
+	if opener == nil {
+		block.appendChild(cmTextNode("]"))
+		return true
+	}
+	if !opener.image && opener.index < ip.inactiveLinkOpenersBefore {
+		block.appendChild(cmTextNode("]"))
+		ip.brackets = opener.previous
+		return true
+	}
+
+	var destination, title string
+	matched := false
+
+	// インラインのリンク
+	if ip.peek() == '(' {
+		ip.pos++
+		ip.skipSpaceAndNewline()
+		if d, ok := ip.parseLinkDestination(); ok {
+			destination = d
+			ip.skipSpaceAndNewline()
+			// タイトルの前には空白が必要
+			if c := ip.subject[ip.pos-1]; c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r' {
+				if t, ok := ip.parseLinkTitle(); ok {
+					title = t
+				}
+			}
+			ip.skipSpaceAndNewline()
+			if ip.peek() == ')' {
+				ip.pos++
+				matched = true
+			}
+		}
+		if !matched {
+			ip.pos = start
+		}
+	}
+
+	// 参照リンク
+	if !matched {
+		beforeLabel := ip.pos
+		n := ip.parseLinkLabel()
+		var label string
+		if n > 2 {
+			label = ip.subject[beforeLabel : beforeLabel+n]
+		} else if !opener.bracketAfter {
+			// [foo][] と [foo] は、最初のラベルを参照として使う
+			label = ip.subject[opener.index:start]
+		}
+		if n == 0 {
+			ip.pos = start
+		}
+		if label != "" {
+			if r, ok := ip.references[cmNormalizeReference(label)]; ok {
+				destination, title = r.destination, r.title
+				matched = true
+			}
+		}
+	}
+
+	if !matched {
+		ip.brackets = opener.previous
+		ip.pos = start
+		block.appendChild(cmTextNode("]"))
+		return true
+	}
+
+	node := &cmNode{kind: cmLink, destination: destination, title: title}
+	if opener.image {
+		node.kind = cmImage
+	}
+	for n := opener.node.next; n != nil; {
+		next := n.next
+		node.appendChild(n)
+		n = next
+	}
+	block.appendChild(node)
+	ip.processEmphasis(opener.previousDelimiter)
+	ip.brackets = opener.previous
+	opener.node.unlink()
+
+	if !opener.image {
+		ip.inactiveLinkOpenersBefore = ip.pos
+	}
+	return true
+}
+
+// 空白と、1 つまでの改行を読み飛ばす
+func (ip *cmInlineParser) skipSpaceAndNewline() {
+	for ip.peek() == ' ' {
+		ip.pos++
+	}
+	if ip.peek() == '\n' {
+		ip.pos++
+		for ip.peek() == ' ' {
+			ip.pos++
+		}
+	}
+}
+
+func (ip *cmInlineParser) parseLinkDestination() (string, bool) {
+	if m := cmLinkDestinationBracesPattern.FindString(ip.subject[ip.pos:]); m != "" {
+		ip.pos += len(m)
+		return cmNormalizeURI(cmUnescapeString(m[1 : len(m)-1])), true
+	}
+	if ip.peek() == '<' {
+		return "", false
+	}
+
+	start := ip.pos
+	openParens := 0
+	for ip.pos < len(ip.subject) {
+		c := ip.subject[ip.pos]
+		if c == '\\' && ip.pos+1 < len(ip.subject) && cmIsASCIIPunctuation(ip.subject[ip.pos+1]) {
+			ip.pos += 2
+			continue
+		}
+		if c == '(' {
+			// 括弧の入れ子は、閉じられていない括弧が続くときに読み直す量を抑えるため 32 段までとする
+			if openParens == 32 {
+				return "", false
+			}
+			openParens++
+		} else if c == ')' {
+			if openParens < 1 {
+				break
+			}
+			openParens--
+		} else if c <= ' ' || c == 0x7f {
+			// 空白と制御文字は含められない
+			break
+		}
+		ip.pos++
+	}
+	if ip.pos == start && ip.peek() != ')' {
+		return "", false
+	}
+	if openParens != 0 {
+		return "", false
+	}
+	return cmNormalizeURI(cmUnescapeString(ip.subject[start:ip.pos])), true
+}
+
+func (ip *cmInlineParser) parseLinkTitle() (string, bool) {
+	m := cmLinkTitlePattern.FindString(ip.subject[ip.pos:])
+	if m == "" {
+		return "", false
+	}
+	ip.pos += len(m)
+	return cmUnescapeString(m[1 : len(m)-1]), true
+}
+
+// [ から ] までのラベルの長さ。ラベルでなければ 0
+func (ip *cmInlineParser) parseLinkLabel() int {
+	if ip.peek() != '[' {
+		return 0
+	}
+	i := ip.pos + 1
+	for i < len(ip.subject) {
+		switch ip.subject[i] {
+		case '\\':
+			if i+1 >= len(ip.subject) {
+				return 0
+			}
+			i += 2
+			continue
+		case '[':
+			return 0
+		case ']':
+			// ラベルの中身は 999 文字まで
+			n := i + 1 - ip.pos
+			if n > 1001 {
+				return 0
+			}
+			ip.pos = i + 1
+			return n
+		}
+		i++
+	}
+	return 0
+}
+
+// s の先頭からリンク参照定義を読み、references に登録する。読んだ長さを返し、定義でなければ 0 を返す
+func (ip *cmInlineParser) parseReference(s string) int {
+	ip.subject = s
+	ip.pos = 0
+
+	n := ip.parseLinkLabel()
+	if n == 0 {
+		return 0
+	}
+	label := s[:n]
+	if ip.peek() != ':' {
+		return 0
+	}
+	ip.pos++
+
+	ip.skipSpaceAndNewline()
+	destination, ok := ip.parseLinkDestination()
+	if !ok {
+		return 0
+	}
+
+	beforeTitle := ip.pos
+	ip.skipSpaceAndNewline()
+	title, hasTitle := "", false
+	if ip.pos != beforeTitle {
+		title, hasTitle = ip.parseLinkTitle()
+	}
+	if !hasTitle {
+		ip.pos = beforeTitle
+	}
+
+	// タイトルの後ろには何も置けない。置かれていれば、タイトルのない定義として読み直す
+	if !ip.skipSpaceToLineEnd() {
+		if title == "" {
+			return 0
+		}
+		title = ""
+		ip.pos = beforeTitle
+		if !ip.skipSpaceToLineEnd() {
+			return 0
+		}
+	}
+
+	normalized := cmNormalizeReference(label)
+	if normalized == "" {
+		return 0
+	}
+	if _, ok := ip.references[normalized]; !ok {
+		ip.references[normalized] = cmReference{destination: destination, title: title}
+	}
+	return ip.pos
+}
+
+// 行末まで空白だけなら、改行の後ろまで読み進める
+func (ip *cmInlineParser) skipSpaceToLineEnd() bool {
+	i := ip.pos
+	for i < len(ip.subject) && ip.subject[i] == ' ' {
+		i++
+	}
+	if i < len(ip.subject) && ip.subject[i] != '\n' {
+		return false
+	}
+	ip.pos = min(i+1, len(ip.subject))
+	return true
+}
+
+func (ip *cmInlineParser) parseAutolink(block *cmNode) bool {
+	s := ip.subject[ip.pos:]
+	if m := cmEmailAutolinkPattern.FindStringSubmatch(s); m != nil {
+		ip.pos += len(m[0])
+		link := &cmNode{kind: cmLink, destination: cmNormalizeURI("mailto:" + m[1])}
+		link.appendChild(cmTextNode(m[1]))
+		block.appendChild(link)
+		return true
+	}
+	if m := cmAutolinkPattern.FindString(s); m != "" {
+		ip.pos += len(m)
+		url := m[1 : len(m)-1]
+		link := &cmNode{kind: cmLink, destination: cmNormalizeURI(url)}
+		link.appendChild(cmTextNode(url))
+		block.appendChild(link)
+		return true
+	}
+	return false
+}
+
+func (ip *cmInlineParser) parseHTMLTag(block *cmNode) bool {
+	m := ip.htmlTags.match(ip.subject[ip.pos:])
+	if m == "" {
+		return false
+	}
+	ip.pos += len(m)
+	block.appendChild(&cmNode{kind: cmHTMLInline, literal: m})
+	return true
+}
+
+func (ip *cmInlineParser) parseEntity(block *cmNode) bool {
+	m := cmEntityPattern.FindString(ip.subject[ip.pos:])
+	if m == "" {
+		return false
+	}
+	ip.pos += len(m)
+	block.appendChild(cmTextNode(cmDecodeEntity(m)))
+	return true
+}
+
+// 文字参照を文字に置き換える。HTML で定義されていない名前はそのまま返す
+func cmDecodeEntity(s string) string {
+	if strings.HasPrefix(s, "&#") {
+		digits, base := s[2:len(s)-1], 10
+		if digits[0] == 'x' || digits[0] == 'X' {
+			digits, base = digits[1:], 16
+		}
+		n, err := strconv.ParseInt(digits, base, 32)
+		if err != nil || n == 0 || !utf8.ValidRune(rune(n)) {
+			return "�"
+		}
+		return string(rune(n))
+	}
+
+	// html.UnescapeString は、名前の一部が定義されていれば残りを文字列として残すので、
+	// 1 つか 2 つの文字に置き換わったときだけ、名前全体が定義されているとみなす
+	d := html.UnescapeString(s)
+	if d == s || utf8.RuneCountInString(d) > 2 {
+		return s
+	}
+	return d
+}
+
+// リンク先やタイトルの、バックスラッシュでのエスケープと文字参照を置き換える
+func cmUnescapeString(s string) string {
+	if !strings.ContainsAny(s, "\\&") {
+		return s
+	}
+	return cmEntityOrEscapedCharPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if m[0] == '\\' {
+			return m[1:]
+		}
+		return cmDecodeEntity(m)
+	})
+}
+
+// リンクのラベルを照合できるよう、空白をまとめて大文字と小文字を区別しないようにする
+func cmNormalizeReference(label string) string {
+	s := strings.Trim(label[1:len(label)-1], " \t\r\n")
+	s = cmReferenceWhitespacePattern.ReplaceAllString(s, " ")
+	// ß の大文字は SS なので、ẞ と SS を同じラベルとして扱う
+	s = strings.ReplaceAll(strings.ToLower(s), "ß", "ss")
+	return strings.ToUpper(s)
+}
+
+// URL に使えない文字をパーセントエンコードする。エンコード済みの部分はそのまま残す
+func cmNormalizeURI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && cmIsHexDigit(s[i+1]) && cmIsHexDigit(s[i+2]) {
+			b.WriteString(s[i : i+3])
+			i += 2
+			continue
+		}
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(";/?:@&=+$,-_.!~*'()#", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func cmIsHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,85 @@
+package md
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+// testdata/commonmark-spec.json は CommonMark 0.31.2 の仕様の例 (https://spec.commonmark.org/0.31.2/spec.json)。
+// 通過する例の数がこれを下回ったら失敗する。通過する例を増やしたら、この値も更新する
+const commonMarkSpecPassed = 652
+
+func TestCommonMarkSpec(t *testing.T) {
+	b, err := os.ReadFile("testdata/commonmark-spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []struct {
+		Markdown string `json:"markdown"`
+		HTML     string `json:"html"`
+		Example  int    `json:"example"`
+		Section  string `json:"section"`
+	}
+	if err := json.Unmarshal(b, &examples); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct{ passed, total int }
+	var sections []string
+	results := make(map[string]*result)
+	passed := 0
+	for _, e := range examples {
+		r, ok := results[e.Section]
+		if !ok {
+			r = &result{}
+			results[e.Section] = r
+			sections = append(sections, e.Section)
+		}
+		r.total++
+
+		// 仕様の例は生の HTML をそのまま出力する
+		var got strings.Builder
+		writeCommonMarkHTML(&htmlWriter{StringWriter: &got}, parseCommonMark(e.Markdown), true)
+		if got.String() != e.HTML {
+			if testing.Verbose() {
+				t.Logf("example %d (%s)\nmarkdown: %q\nexpect:   %q\ngot:      %q", e.Example, e.Section, e.Markdown, e.HTML, got.String())
+			}
+			continue
+		}
+		r.passed++
+		passed++
+	}
+
+	// go test -v で、節ごとの通過率を確認できる
+	for _, s := range sections {
+		r := results[s]
+		t.Logf("%-40s %3d/%3d (%5.1f%%)", s, r.passed, r.total, float64(r.passed)*100/float64(r.total))
+	}
+	t.Logf("%-40s %3d/%3d (%5.1f%%)", "total", passed, len(examples), float64(passed)*100/float64(len(examples)))
+
+	if passed < commonMarkSpecPassed {
+		t.Errorf("passed %d examples, expected at least %d", passed, commonMarkSpecPassed)
+	}
+}
+
+func TestCommonMark(t *testing.T) {
+	toHTML := func(md string) string {
+		return ToHTMLWithOptions(md, Options{CommonMark: true})
+	}
+
+	test.AssertEquals(t, toHTML("# a\n\n- b\n- c\n"), "<h1>a</h1>\n<ul>\n<li>b</li>\n<li>c</li>\n</ul>\n")
+	// 通常のパーサーで独自の意味を持つ記法は、CommonMark では通常の文字列になる
+	test.AssertEquals(t, toHTML("[^1] $x$ ==a=="), "<p>[^1] $x$ ==a==</p>\n")
+	test.AssertEquals(t, ToHTMLWithOptions("a\n\n> b", Options{CommonMark: true, SourceLine: true}),
+		"<p data-source-line=\"1\">a</p>\n<blockquote data-source-line=\"3\">\n<p data-source-line=\"3\">b</p>\n</blockquote>\n")
+	test.AssertEquals(t, strings.Count(toHTML(strings.Repeat("[", 10000)), "["), 10000)
+	test.AssertEquals(t, strings.Count(toHTML(strings.Repeat("a <!-- ", 10000)), "&lt;!--"), 10000)
+	// 生の HTML と URL は検証してから出力する
+	test.AssertEquals(t, toHTML("<div onclick=\"x()\">\n<script>alert(1)</script>\n</div>\n\nPress <kbd>C</kbd>"),
+		"<div>\n\n</div>\n<p>Press <kbd>C</kbd></p>\n")
+	test.AssertEquals(t, toHTML("[a](javascript:alert(1)) ![b](javascript:alert(1))"), "<p><a>a</a> <img src=\"\" alt=\"b\" /></p>\n")
+}
@@ -0,0 +1,83 @@
+package md
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"math"
+	"strconv"
+)
+
+// コードブロックの言語名ごとの図の描画関数。
+// エラーを返したときは、通常のコードブロックとして出力する。
+var diagramRenderers = map[string]func(src string) (string, error){
+	"mermaid": renderMermaid,
+}
+
+const (
+	diagramFontSize   = 14.0
+	diagramMargin     = 16.0
+	diagramNodeHeight = 40.0
+)
+
+// 等幅ではないフォントの描画幅を、ASCII とそれ以外の文字で大まかに見積もる
+func estimateTextWidth(s string) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r < 0x80 {
+			w += diagramFontSize * 0.6
+		} else {
+			w += diagramFontSize
+		}
+	}
+	return w
+}
+
+func formatSVGNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+// 同じ文書に複数の図があっても marker の id が衝突しないよう、図の中身から id の接頭辞を作る
+func diagramIDPrefix(src string) string {
+	h := fnv.New32a()
+	h.Write([]byte(src))
+	return fmt.Sprintf("d%x", h.Sum32())
+}
+
+func svgStart(class string, width, height float64) string {
+	return fmt.Sprintf(
+		"<svg xmlns=\"http://www.w3.org/2000/svg\" class=\"%s\" viewBox=\"0 0 %s %s\" width=\"%s\" height=\"%s\" font-size=\"%s\" font-family=\"sans-serif\">",
+		class,
+		formatSVGNumber(width), formatSVGNumber(height),
+		formatSVGNumber(width), formatSVGNumber(height),
+		formatSVGNumber(diagramFontSize),
+	)
+}
+
+func svgMarkers(prefix string) string {
+	return "<defs>" +
+		"<marker id=\"" + prefix + "-arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto-start-reverse\">" +
+		"<path d=\"M 0 0 L 10 5 L 0 10 z\" fill=\"#333\"></path></marker>" +
+		"<marker id=\"" + prefix + "-open\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto-start-reverse\">" +
+		"<path d=\"M 0 0 L 10 5 L 0 10\" fill=\"none\" stroke=\"#333\"></path></marker>" +
+		"<marker id=\"" + prefix + "-cross\" viewBox=\"0 0 10 10\" refX=\"5\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\">" +
+		"<path d=\"M 0 0 L 10 10 M 10 0 L 0 10\" stroke=\"#333\" stroke-width=\"2\"></path></marker>" +
+		"</defs>"
+}
+
+func svgText(x, y float64, s string) string {
+	return fmt.Sprintf(
+		"<text x=\"%s\" y=\"%s\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text>",
+		formatSVGNumber(x), formatSVGNumber(y), html.EscapeString(s),
+	)
+}
+
+// 背景付きのラベル。線の上に重ねても読めるようにする
+func svgLabel(x, y float64, s string) string {
+	w := estimateTextWidth(s) + 8
+	h := diagramFontSize + 6
+	return fmt.Sprintf(
+		"<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"#fff\"></rect>",
+		formatSVGNumber(x-w/2), formatSVGNumber(y-h/2), formatSVGNumber(w), formatSVGNumber(h),
+	) + svgText(x, y, s)
+}
@@ -1,18 +1,52 @@
 package md
 
 type blockElement struct {
-	kind     blockElementKind
+	kind blockElementKind
+	// 元の文書での開始行と終了行 (1 から始まり、両端を含む)
+	line     int
+	endLine  int
 	children inlineElement
 	// 1 or greater than 1
-	listLevel          int
-	imageSrc           string
-	imageCaption       string
-	codeName           string
-	codeText           string
-	checkboxList       bool
-	checkboxIsChecked  bool
-	detailsSummary     string
-	detailsContentHTML string
+	listLevel         int
+	listOrdered       bool
+	listStart         int
+	imageSrc          string
+	imageCaption      string
+	codeInfo          codeBlockInfo
+	codeText          string
+	mathText          string
+	checkboxList      bool
+	checkboxIsChecked bool
+	detailsSummary    string
+	calloutKind       string
+	calloutTitle      string
+	// :::details や引用などの中身
+	blocks          []blockElement
+	headingID       string
+	footnoteLabel   string
+	tableHeader     []inlineElement
+	tableAlignments []tableAlignment
+	tableRows       [][]inlineElement
+	// HTML のブロックの行。出力するときに、許可されたタグと属性だけにする
+	rawHTML string
+}
+
+type tableAlignment int
+
+const (
+	tableAlignmentNone tableAlignment = iota
+	tableAlignmentLeft
+	tableAlignmentCenter
+	tableAlignmentRight
+)
+
+// コードブロックの開始行 (```go:main.go {3-5} showLineNumbers) の情報
+type codeBlockInfo struct {
+	language string
+	fileName string
+	// 強調する行の範囲。行番号は 1 から始まり、両端を含む
+	highlightLines  [][2]int
+	showLineNumbers bool
 }
 
 type blockElementKind int
@@ -25,9 +59,19 @@ const (
 	blockElementKindHeading1
 	blockElementKindHeading2
 	blockElementKindHeading3
+	blockElementKindHeading4
+	blockElementKindHeading5
+	blockElementKindHeading6
 	// 空行が挟まれたとき、リストを分割できるようにするための疑似要素
 	blockElementKindEmpty
 	blockElementDetails
+	blockElementKindTable
+	blockElementKindBlockquote
+	blockElementKindTOC
+	blockElementKindFootnoteDefinition
+	blockElementKindCallout
+	blockElementKindMath
+	blockElementKindHTML
 )
 
 type inlineElementKind int
@@ -38,6 +82,14 @@ const (
 	inlineElementKindBold
 	inlineElementKindCode
 	inlineElementKindLink
+	inlineElementKindItalic
+	inlineElementKindStrikethrough
+	inlineElementKindMark
+	inlineElementKindFootnoteReference
+	inlineElementKindRuby
+	inlineElementKindMath
+	// HTML のタグ。s には元の文字列が入る
+	inlineElementKindHTML
 )
 
 type inlineElement struct {
@@ -46,6 +98,13 @@ type inlineElement struct {
 	children []inlineElement
 
 	linkHref string
+	rubyText string
+
+	footnoteLabel string
+	// 脚注の番号。定義されていない脚注のときは 0
+	footnoteNumber int
+	// 同じ脚注への何回目の参照か (1 から始まる)
+	footnoteReferenceIndex int
 }
 
 type token struct {
@@ -53,4 +112,9 @@ type token struct {
 	r bool
 	// トークンに含まれる文字列
 	s string
+	// 拡張によって解釈済みのインライン要素。s には元の文字列が入る
+	e *inlineElement
+	// 直後に空白がある * は強調を開かず、直前に空白がある * は強調を閉じない
+	cannotOpen  bool
+	cannotClose bool
 }
@@ -0,0 +1,221 @@
+package md
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 独自のブロック要素の構文。
+// end が nil のときは 1 行で完結する要素、そうでなければ end の行までを中身に持つコンテナとして扱う。
+type blockExtension struct {
+	// 行頭からの開始行のパターン。行末の空白は取り除いてから照合する
+	start *regexp.Regexp
+	// コンテナの終了行のパターン。中身に start と一致する行があれば、入れ子として数える
+	end *regexp.Regexp
+	// m は開始行のマッチ結果。lines はコンテナの中身で、contentLine は lines[0] の元の文書での行番号
+	// 中身は p.parse でパースする。行番号は呼び出し側で設定する
+	parse func(p *blockParser, m []string, lines []string, contentLine int) blockElement
+	// parse が返す要素の種類と、その HTML への変換。render が nil のときは既存の変換を使う。
+	// 同じ種類に複数の render があるときは、最初に登録されたものを使う
+	kind   blockElementKind
+	render func(w *htmlWriter, e blockElement)
+}
+
+// 独自のインライン要素の構文
+type inlineExtension struct {
+	// この文字から始まるときに parse を試す
+	trigger rune
+	// s[start] から始まる要素を解釈し、要素の最後の文字の位置を返す。要素でなければ ok を false にする
+	parse func(s []rune, start int) (e inlineElement, end int, ok bool)
+	kind  inlineElementKind
+	// render が nil のときは既存の変換を使う
+	render func(w *htmlWriter, e inlineElement)
+}
+
+// 登録順に試すので、より限定的な構文を先に登録する必要がある
+var (
+	blockExtensions  []blockExtension
+	inlineExtensions []inlineExtension
+)
+
+func registerBlockExtension(e blockExtension) {
+	blockExtensions = append(blockExtensions, e)
+}
+
+func registerInlineExtension(e inlineExtension) {
+	inlineExtensions = append(inlineExtensions, e)
+}
+
+func blockRenderer(kind blockElementKind) func(w *htmlWriter, e blockElement) {
+	for _, ext := range blockExtensions {
+		if ext.kind == kind && ext.render != nil {
+			return ext.render
+		}
+	}
+	return nil
+}
+
+func inlineRenderer(kind inlineElementKind) func(w *htmlWriter, e inlineElement) {
+	for _, ext := range inlineExtensions {
+		if ext.kind == kind && ext.render != nil {
+			return ext.render
+		}
+	}
+	return nil
+}
+
+// parseBlockLines などから参照されるので、初期化の循環を避けるため init で登録する
+func init() {
+	registerBlockExtension(blockExtension{
+		start: regexp.MustCompile(`^<details>$`),
+		end:   regexp.MustCompile(`^</details>$`),
+		parse: parseHTMLDetails,
+		kind:  blockElementDetails,
+		render: func(w *htmlWriter, e blockElement) {
+			summary := e.detailsSummary
+			if summary == "" {
+				summary = "詳細"
+			}
+			w.WriteString("<details" + w.sourceLineAttr(e) + "><summary>" + html.EscapeString(summary) + "</summary>")
+			writeBlockElementsHTML(w, e.blocks)
+			w.WriteString("</details>")
+		},
+	})
+
+	// <details> の特別な扱いより後に試す
+	registerBlockExtension(blockExtension{
+		start: blockHTMLPattern,
+		parse: func(_ *blockParser, m []string, _ []string, _ int) blockElement {
+			return blockElement{kind: blockElementKindHTML, rawHTML: m[0]}
+		},
+		kind: blockElementKindHTML,
+		render: func(w *htmlWriter, e blockElement) {
+			w.blockHTML.write(w, e.rawHTML)
+		},
+	})
+
+	registerBlockExtension(blockExtension{
+		start: regexp.MustCompile("^:::(details|note|tip|warning|alert)(?: +(.*))?$"),
+		end:   regexp.MustCompile("^:::$"),
+		parse: func(p *blockParser, m []string, lines []string, contentLine int) blockElement {
+			return containerBlockElement(p, m[1], m[2], lines, contentLine)
+		},
+		kind: blockElementKindCallout,
+		render: func(w *htmlWriter, e blockElement) {
+			w.WriteString("<aside class=\"callout callout-" + html.EscapeString(e.calloutKind) + "\"" + w.sourceLineAttr(e) + ">")
+			if e.calloutTitle != "" {
+				w.WriteString("<p class=\"callout-title\">" + html.EscapeString(e.calloutTitle) + "</p>")
+			}
+			writeBlockElementsHTML(w, e.blocks)
+			w.WriteString("</aside>")
+		},
+	})
+
+	// 簡単のため、リストのインデントは常にスペース2つとする
+	// チェックボックスも有効なリストなので、リストより前に検証する必要がある
+	registerBlockExtension(blockExtension{
+		start: regexp.MustCompile(`^((?:  )*)- \[([ x])\] (.+)$`),
+		parse: func(_ *blockParser, m []string, _ []string, _ int) blockElement {
+			return blockElement{
+				kind:              blockElementKindList,
+				children:          parseInlineTree(m[3]),
+				listLevel:         len(m[1])/2 + 1,
+				checkboxList:      true,
+				checkboxIsChecked: m[2] == "x",
+			}
+		},
+		kind: blockElementKindList,
+	})
+
+	registerBlockExtension(blockExtension{
+		start: regexp.MustCompile(`^!\[(.+)\]\((https:\/\/[\w/.\-_]+)\)$`),
+		parse: func(_ *blockParser, m []string, _ []string, _ int) blockElement {
+			return blockElement{
+				kind:         blockElementKindImage,
+				imageSrc:     m[2],
+				imageCaption: m[1],
+			}
+		},
+		kind: blockElementKindImage,
+		render: func(w *htmlWriter, e blockElement) {
+			caption := html.EscapeString(e.imageCaption)
+			w.WriteString("<figure" + w.sourceLineAttr(e) + "><img src=\"" + html.EscapeString(e.imageSrc) + "\" alt=\"" + caption + "\"><figcaption>" + caption + "</figcaption></figure>")
+		},
+	})
+
+	// $...$ の中身は LaTeX なので、トークンに分割せずにそのまま取り出す
+	registerInlineExtension(inlineExtension{
+		trigger: '$',
+		parse: func(s []rune, start int) (inlineElement, int, bool) {
+			end := findInlineMathEnd(s, start)
+			if end < 0 {
+				return inlineElement{}, 0, false
+			}
+			return inlineElement{kind: inlineElementKindMath, s: string(s[start+1 : end])}, end, true
+		},
+		kind: inlineElementKindMath,
+		render: func(w *htmlWriter, e inlineElement) {
+			w.WriteString(latexToMathML(e.s, false))
+		},
+	})
+
+	registerInlineExtension(inlineExtension{
+		trigger: '<',
+		parse:   parseInlineHTML,
+		kind:    inlineElementKindHTML,
+		render: func(w *htmlWriter, e inlineElement) {
+			if w.inlineHTML == nil {
+				z := &htmlSanitizer{}
+				z.write(w, e.s)
+				z.close(w)
+				return
+			}
+			w.inlineHTML.write(w, e.s)
+		},
+	})
+}
+
+var detailsSummaryPattern = regexp.MustCompile(`^<summary>(.+)<\/summary>$`)
+
+// <details> の中身を解釈する。最初の <summary> の行を要約として取り出す。
+func parseHTMLDetails(p *blockParser, _ []string, lines []string, contentLine int) blockElement {
+	e := blockElement{kind: blockElementDetails}
+
+	// 要約の行は、入れ子の <details> の中にあっても使う。行番号がずれないよう、先頭以外では空行として扱われる
+	if line := p.takeSummaryLine(contentLine, contentLine+len(lines)-1); line > 0 {
+		e.detailsSummary = detailsSummaryPattern.FindStringSubmatch(lines[line-contentLine])[1]
+		if line == contentLine {
+			lines = lines[1:]
+			contentLine++
+		}
+	}
+
+	e.blocks = p.parse(lines, contentLine)
+	return e
+}
+
+// 長い行で毎回行末まで調べないよう、タグの長さを制限する
+const maxInlineHTMLLength = 1000
+
+// s[start] から始まる、許可されたタグを解釈する。属性は出力するときに検証する
+func parseInlineHTML(s []rune, start int) (inlineElement, int, bool) {
+	if start+1 >= len(s) || !(s[start+1] == '/' || isASCIIAlphanumeric(s[start+1])) {
+		return inlineElement{}, 0, false
+	}
+	// タグは > で終わるので、最後の > より後ろは照合しない
+	end := min(len(s), start+maxInlineHTMLLength)
+	for end > start && s[end-1] != '>' {
+		end--
+	}
+	m := inlineHTMLPattern.FindString(string(s[start:end]))
+	if m == "" {
+		return inlineElement{}, 0, false
+	}
+	name := htmlTagNamePattern.FindStringSubmatch(m)
+	if _, ok := inlineHTMLTags[strings.ToLower(name[1])]; !ok {
+		return inlineElement{}, 0, false
+	}
+	return inlineElement{kind: inlineElementKindHTML, s: m}, start + utf8.RuneCountInString(m) - 1, true
+}
@@ -0,0 +1,69 @@
+package md
+
+import (
+	"html"
+	"regexp"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestExtension(t *testing.T) {
+	blocks, inlines := blockExtensions, inlineExtensions
+	defer func() {
+		blockExtensions, inlineExtensions = blocks, inlines
+	}()
+
+	// 既存の要素の種類を借りて、独自の構文を追加する
+	registerBlockExtension(blockExtension{
+		start: regexp.MustCompile(`^@@@ (.+)$`),
+		end:   regexp.MustCompile(`^@@@$`),
+		parse: func(p *blockParser, m []string, lines []string, contentLine int) blockElement {
+			return blockElement{
+				kind:         blockElementKindCallout,
+				calloutKind:  "custom",
+				calloutTitle: m[1],
+				blocks:       p.parse(lines, contentLine),
+			}
+		},
+		kind: blockElementKindCallout,
+	})
+	registerInlineExtension(inlineExtension{
+		trigger: '@',
+		parse: func(s []rune, start int) (inlineElement, int, bool) {
+			end := start + 1
+			for end < len(s) && isASCIIAlphanumeric(s[end]) {
+				end++
+			}
+			if end == start+1 {
+				return inlineElement{}, 0, false
+			}
+			return inlineElement{kind: inlineElementKindLink, linkHref: "https://example.com/" + string(s[start+1:end])}, end - 1, true
+		},
+		kind: inlineElementKindLink,
+		render: func(w *htmlWriter, e inlineElement) {
+			w.WriteString("<a class=\"mention\" href=\"" + html.EscapeString(e.linkHref) + "\">@</a>")
+		},
+	})
+
+	got := ToHTML(`@@@ title
+hello @comame
+@@@ nested
+- [x] done
+@@@
+@@@
+@ alone`)
+	expect := "<aside class=\"callout callout-custom\"><p class=\"callout-title\">title</p>" +
+		"<p>hello <a class=\"mention\" href=\"https://example.com/comame\">@</a></p>" +
+		"<aside class=\"callout callout-custom\"><p class=\"callout-title\">nested</p>" +
+		"<ul><li><input type='checkbox' checked inert>done</li></ul></aside></aside>" +
+		"<p>@ alone</p>"
+	test.AssertSame(t, got, expect)
+
+	d, err := Parse("@@@ title\ntext\n@@@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEquals(t, d.Children[0].Position, Position{Line: 1, EndLine: 3})
+	test.AssertEquals(t, d.Children[0].Children[0].Position, Position{Line: 2, EndLine: 2})
+}
@@ -0,0 +1,113 @@
+package md
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type footnote struct {
+	number int
+	// 本文中から参照された回数
+	referenceCount int
+	content        inlineElement
+}
+
+// 脚注の参照に、最初に参照された順で番号を振る。
+// 定義されていない脚注への参照と、参照されていない脚注の定義は無視する。
+func resolveFootnotes(elements []blockElement) []footnote {
+	definitions := make(map[string]inlineElement)
+	walkBlockElements(elements, func(e *blockElement) {
+		if e.kind != blockElementKindFootnoteDefinition {
+			return
+		}
+		// 同じ名前の脚注が複数定義されたときは、最初の定義を使う
+		if _, ok := definitions[e.footnoteLabel]; !ok {
+			definitions[e.footnoteLabel] = e.children
+		}
+	})
+
+	var ret []footnote
+	numbers := make(map[string]int)
+
+	visit := func(e *inlineElement) {
+		if e.kind != inlineElementKindFootnoteReference {
+			return
+		}
+		content, ok := definitions[e.footnoteLabel]
+		if !ok {
+			return
+		}
+
+		n, ok := numbers[e.footnoteLabel]
+		if !ok {
+			ret = append(ret, footnote{number: len(ret) + 1, content: content})
+			n = len(ret)
+			numbers[e.footnoteLabel] = n
+		}
+
+		ret[n-1].referenceCount++
+		e.footnoteNumber = n
+		e.footnoteReferenceIndex = ret[n-1].referenceCount
+	}
+
+	walkBlockElements(elements, func(e *blockElement) {
+		if e.kind == blockElementKindFootnoteDefinition {
+			return
+		}
+		walkInlineElementsOfBlock(e, visit)
+	})
+
+	return ret
+}
+
+// :::details や引用の中も含めて、全てのブロック要素を出現順に訪問する
+func walkBlockElements(elements []blockElement, f func(e *blockElement)) {
+	for i := range elements {
+		f(&elements[i])
+		walkBlockElements(elements[i].blocks, f)
+	}
+}
+
+// ブロック要素に含まれる全てのインライン要素を訪問する
+func walkInlineElementsOfBlock(e *blockElement, f func(e *inlineElement)) {
+	walkInlineElement(&e.children, f)
+	for j := range e.tableHeader {
+		walkInlineElement(&e.tableHeader[j], f)
+	}
+	for j := range e.tableRows {
+		for k := range e.tableRows[j] {
+			walkInlineElement(&e.tableRows[j][k], f)
+		}
+	}
+}
+
+func walkInlineElement(e *inlineElement, f func(e *inlineElement)) {
+	f(e)
+	for i := range e.children {
+		walkInlineElement(&e.children[i], f)
+	}
+}
+
+func footnoteReferenceID(number, index int) string {
+	if index <= 1 {
+		return fmt.Sprintf("fnref-%d", number)
+	}
+	return fmt.Sprintf("fnref-%d-%d", number, index)
+}
+
+func writeFootnotesHTML(w *htmlWriter, footnotes []footnote) {
+	if len(footnotes) == 0 {
+		return
+	}
+
+	w.WriteString("<section class=\"footnotes\"><ol>")
+	for _, f := range footnotes {
+		w.WriteString("<li id=\"fn-" + strconv.Itoa(f.number) + "\">")
+		writeInlineElementHTML(w, f.content)
+		for i := 1; i <= f.referenceCount; i++ {
+			w.WriteString(" <a href=\"#" + footnoteReferenceID(f.number, i) + "\" class=\"footnote-backref\">↩</a>")
+		}
+		w.WriteString("</li>")
+	}
+	w.WriteString("</ol></section>")
+}
@@ -0,0 +1,30 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestFootnote(t *testing.T) {
+	got := ToHTML(`a[^b] c[^a] d[^b] e[^none]
+
+[^a]: note **a**
+[^b]: note b
+[^unused]: unused`)
+	expect := "<p>a<sup class=\"footnote-ref\"><a href=\"#fn-1\" id=\"fnref-1\">1</a></sup>" +
+		" c<sup class=\"footnote-ref\"><a href=\"#fn-2\" id=\"fnref-2\">2</a></sup>" +
+		" d<sup class=\"footnote-ref\"><a href=\"#fn-1\" id=\"fnref-1-2\">1</a></sup>" +
+		" e[^none]</p>" +
+		"<section class=\"footnotes\"><ol>" +
+		"<li id=\"fn-1\">note b <a href=\"#fnref-1\" class=\"footnote-backref\">↩</a> <a href=\"#fnref-1-2\" class=\"footnote-backref\">↩</a></li>" +
+		"<li id=\"fn-2\">note <b>a</b> <a href=\"#fnref-2\" class=\"footnote-backref\">↩</a></li>" +
+		"</ol></section>"
+	test.AssertSame(t, got, expect)
+
+	// 脚注が無ければ何も追加しない
+	test.AssertSame(t, ToHTML("[^a]"), "<p>[^a]</p>")
+
+	// [^a](...) はリンク
+	test.AssertSame(t, ToHTML("[^a](https://example.com)\n\n[^a]: a"), "<p><a href=\"https://example.com\">^a</a></p>")
+}
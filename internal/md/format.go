@@ -0,0 +1,547 @@
+package md
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Markdown を決まった書き方に整形する。
+// リストのインデントはスペース2つ、<details> は :::details、コードブロックの開始行は決まった順序にし、
+// 連続する空行を 1 つにまとめ、行末の空白を取り除く。何度整形しても結果は変わらない。
+// 整形すると意味が変わってしまう部分は、空行で区切られた範囲ごとに元の書き方のまま残し、*FormatError とともに返す。
+func Format(md string) (string, error) {
+	if !utf8.ValidString(md) {
+		return "", ErrInvalidUTF8
+	}
+
+	lines := strings.Split(md, "\n")
+	elements := normalizeBlockElements(parseBlockLines(lines, 1))
+	if len(elements) == 0 {
+		return "", nil
+	}
+
+	if s, ok := blockElementsToMarkdown(elements); ok {
+		return s + "\n", nil
+	}
+
+	var sections []string
+	var starts, unformatted []int
+	for _, section := range splitBlockElementsByEmpty(elements) {
+		starts = append(starts, section[0].line)
+		if s, ok := blockElementsToMarkdown(section); ok {
+			sections = append(sections, s)
+			continue
+		}
+		first, last := section[0], section[len(section)-1]
+		sections = append(sections, strings.Join(lines[first.line-1:last.endLine], "\n"))
+		unformatted = append(unformatted, first.line)
+	}
+
+	s := strings.Join(sections, "\n\n")
+	if !blockElementsEqual(normalizeBlockElements(parseBlock(s)), elements) {
+		// 範囲ごとに分けても意味が変わってしまうときは、元の文書をそのまま返す
+		return md, &FormatError{Lines: starts}
+	}
+	if len(unformatted) > 0 {
+		return s + "\n", &FormatError{Lines: unformatted}
+	}
+	return s + "\n", nil
+}
+
+// Format が整形できず、元の書き方のまま残した部分があることを表す
+type FormatError struct {
+	// 元の書き方のまま残した範囲の、元の文書での開始行
+	Lines []int
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("markdown is left unformatted at lines %v", e.Lines)
+}
+
+// 空行で区切る。区切りの空行は含めない
+func splitBlockElementsByEmpty(elements []blockElement) [][]blockElement {
+	var ret [][]blockElement
+	start := 0
+	for i, e := range elements {
+		if e.kind != blockElementKindEmpty {
+			continue
+		}
+		if i > start {
+			ret = append(ret, elements[start:i])
+		}
+		start = i + 1
+	}
+	if start < len(elements) {
+		ret = append(ret, elements[start:])
+	}
+	return ret
+}
+
+// ブロック要素を Markdown に戻す。パースし直して同じ要素にならなければ ok を false にする。
+// 要素ごとにエスケープが必要かを確かめて出力し、文書全体で意味が変わるときは記法として解釈されうる記号を全てエスケープする。
+func blockElementsToMarkdown(elements []blockElement) (s string, ok bool) {
+	for _, escape := range []bool{false, true} {
+		s = markdownPrinter{escape: escape}.document(elements)
+		if blockElementsEqual(parseBlock(s), elements) {
+			return s, true
+		}
+	}
+	return s, false
+}
+
+// 出力が変わらない範囲で、ブロック要素を正規化する。
+// 連続する空行と先頭・末尾の空行を取り除き、リストの深さを 1 つずつ深くなるように振り直す。
+func normalizeBlockElements(elements []blockElement) []blockElement {
+	var ret []blockElement
+	// 元の文書での、開いているリストの深さ
+	var listLevels []int
+
+	for _, e := range elements {
+		if e.kind == blockElementKindEmpty && (len(ret) == 0 || ret[len(ret)-1].kind == blockElementKindEmpty) {
+			continue
+		}
+
+		if e.kind == blockElementKindList {
+			for len(listLevels) > 0 && listLevels[len(listLevels)-1] > e.listLevel {
+				listLevels = listLevels[:len(listLevels)-1]
+			}
+			if len(listLevels) == 0 || listLevels[len(listLevels)-1] < e.listLevel {
+				listLevels = append(listLevels, e.listLevel)
+			}
+			e.listLevel = len(listLevels)
+		} else {
+			listLevels = nil
+		}
+
+		e.blocks = normalizeBlockElements(e.blocks)
+		// 中身が空行だけの引用は、空行を 1 つ残さないと書き表せない
+		if e.kind == blockElementKindBlockquote && len(e.blocks) == 0 {
+			e.blocks = []blockElement{{kind: blockElementKindEmpty}}
+		}
+		ret = append(ret, e)
+	}
+
+	if len(ret) > 0 && ret[len(ret)-1].kind == blockElementKindEmpty {
+		ret = ret[:len(ret)-1]
+	}
+	return ret
+}
+
+// ブロック要素を Markdown に戻す
+type markdownPrinter struct {
+	// 紛らわしいかどうかを確かめずに、記法として解釈されうる記号を全てエスケープする
+	escape bool
+}
+
+// 末尾の空行も 1 つの要素なので、最後の行の後には改行を付けない
+func (p markdownPrinter) document(elements []blockElement) string {
+	return strings.Join(p.blockElements(elements), "\n")
+}
+
+func (p markdownPrinter) blockElements(elements []blockElement) []string {
+	var ret []string
+	for _, e := range elements {
+		ret = append(ret, p.blockElement(e)...)
+	}
+	return ret
+}
+
+// 書き方の候補のうち、パースし直して同じ要素になる最初のものを返す
+func (p markdownPrinter) blockElement(e blockElement) []string {
+	switch e.kind {
+	case blockElementKindEmpty:
+		return []string{""}
+	case blockElementKindBlockquote:
+		var ret []string
+		for _, l := range p.blockElements(e.blocks) {
+			if l == "" {
+				ret = append(ret, ">")
+			} else {
+				ret = append(ret, "> "+l)
+			}
+		}
+		return ret
+	}
+
+	var candidates [][]string
+	switch e.kind {
+	case blockElementDetails, blockElementKindCallout:
+		// 中身は 1 度だけ出力して両方の候補で使う。候補ごとに出力し直すと、入れ子の深さに対して指数的に遅くなる
+		inner := p.blockElements(e.blocks)
+		candidates = append(candidates, containerLines(e, inner, false))
+		if e.kind == blockElementDetails {
+			candidates = append(candidates, containerLines(e, inner, true))
+		}
+	default:
+		if !p.escape {
+			candidates = append(candidates, p.leafLines(e, false))
+		}
+		candidates = append(candidates, p.leafLines(e, true))
+	}
+
+	for _, c := range candidates {
+		if blockElementsEqual(parseBlockFragment(c, 1), []blockElement{e}) {
+			return c
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// 出力済みの中身 inner を :::details などで囲む。html のときは <details> で囲む
+func containerLines(e blockElement, inner []string, html bool) []string {
+	var start, end string
+	switch {
+	case html:
+		start, end = "<details>", "</details>"
+	case e.kind == blockElementDetails:
+		start, end = ":::details", ":::"
+		if e.detailsSummary != "" {
+			start += " " + e.detailsSummary
+		}
+	default:
+		start, end = ":::"+e.calloutKind, ":::"
+		if e.calloutTitle != "" {
+			start += " " + e.calloutTitle
+		}
+	}
+
+	ret := make([]string, 0, len(inner)+3)
+	ret = append(ret, start)
+	if html && e.detailsSummary != "" {
+		ret = append(ret, "<summary>"+e.detailsSummary+"</summary>")
+	}
+	ret = append(ret, inner...)
+	return append(ret, end)
+}
+
+// 中身にブロック要素を持たない要素。escape のときは記法として解釈されうる記号を全てエスケープする
+func (p markdownPrinter) leafLines(e blockElement, escape bool) []string {
+	inline := func(root inlineElement, table bool) string {
+		s := inlineElementToMarkdown(root, escape, table)
+		// 行末の空白は取り除かれるので、行末の \ で残す。テーブルのセルは前後の空白が取り除かれるので残せない
+		if !table && strings.TrimRightFunc(s, unicode.IsSpace) != s {
+			s += "\\"
+		}
+		return s
+	}
+
+	switch e.kind {
+	case blockElementKindParagraph:
+		var ret []string
+		for _, l := range e.children.children {
+			s := inline(l, false)
+			if escape {
+				s = escapeMarkdownLineStart(s)
+			}
+			// \ だけの行は、空の段落の行になる
+			if s == "" {
+				s = "\\"
+			}
+			ret = append(ret, s)
+		}
+		return ret
+	case blockElementKindList:
+		marker := "- "
+		switch {
+		case e.checkboxList && e.checkboxIsChecked:
+			marker = "- [x] "
+		case e.checkboxList:
+			marker = "- [ ] "
+		case e.listOrdered:
+			marker = strconv.Itoa(e.listStart) + ". "
+		}
+		return []string{strings.Repeat("  ", e.listLevel-1) + marker + inline(e.children, false)}
+	case blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+		blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6:
+		return []string{strings.Repeat("#", headingLevel(e.kind)) + " " + inline(e.children, false)}
+	case blockElementKindFootnoteDefinition:
+		return []string{"[^" + e.footnoteLabel + "]: " + inline(e.children, false)}
+	case blockElementKindImage:
+		return []string{"![" + e.imageCaption + "](" + e.imageSrc + ")"}
+	case blockElementKindTOC:
+		return []string{"[[toc]]"}
+	case blockElementKindCodeBlock:
+		ret := []string{"```" + codeBlockInfoToMarkdown(e.codeInfo)}
+		if e.codeText != "" {
+			ret = append(ret, strings.Split(e.codeText, "\n")...)
+		}
+		return append(ret, "```")
+	case blockElementKindMath:
+		ret := []string{"$$"}
+		if e.mathText != "" {
+			ret = append(ret, strings.Split(e.mathText, "\n")...)
+		}
+		return append(ret, "$$")
+	case blockElementKindHTML:
+		return []string{e.rawHTML}
+	case blockElementKindTable:
+		row := func(cells []inlineElement) string {
+			var b strings.Builder
+			b.WriteString("|")
+			for _, c := range cells {
+				b.WriteString(" " + inline(c, true) + " |")
+			}
+			return b.String()
+		}
+
+		delimiter := "|"
+		for _, a := range e.tableAlignments {
+			switch a {
+			case tableAlignmentLeft:
+				delimiter += " :--- |"
+			case tableAlignmentCenter:
+				delimiter += " :---: |"
+			case tableAlignmentRight:
+				delimiter += " ---: |"
+			default:
+				delimiter += " --- |"
+			}
+		}
+
+		ret := []string{row(e.tableHeader), delimiter}
+		for _, r := range e.tableRows {
+			ret = append(ret, row(r))
+		}
+		return ret
+	}
+
+	panic("invalid blockElementKind")
+}
+
+// ```go:main.go {1,3-5} showLineNumbers の ``` 以降
+func codeBlockInfoToMarkdown(info codeBlockInfo) string {
+	var fields []string
+
+	if info.language != "" || info.fileName != "" {
+		f := info.language
+		if info.fileName != "" {
+			f += ":" + info.fileName
+		}
+		fields = append(fields, f)
+	}
+
+	if len(info.highlightLines) > 0 {
+		var ranges []string
+		for _, r := range info.highlightLines {
+			if r[0] == r[1] {
+				ranges = append(ranges, strconv.Itoa(r[0]))
+			} else {
+				ranges = append(ranges, strconv.Itoa(r[0])+"-"+strconv.Itoa(r[1]))
+			}
+		}
+		fields = append(fields, "{"+strings.Join(ranges, ",")+"}")
+	}
+
+	if info.showLineNumbers {
+		fields = append(fields, "showLineNumbers")
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// インライン要素を Markdown に戻す。
+// escape でなければ記法と紛らわしい文字をそのまま書き、パースし直して同じにならなければ記法として解釈されうる記号を全てエスケープする。
+// table のときは、テーブルのセルの区切りにならないよう | をエスケープする。
+func inlineElementToMarkdown(root inlineElement, escape, table bool) string {
+	if !escape {
+		var b strings.Builder
+		writeInlineMarkdown(&b, root, false, table)
+		if s := b.String(); inlineElementEqual(parseInlineTree(s), root) {
+			return s
+		}
+	}
+
+	var b strings.Builder
+	writeInlineMarkdown(&b, root, true, table)
+	return b.String()
+}
+
+func writeInlineMarkdown(b *strings.Builder, e inlineElement, escape, table bool) {
+	// \ は、エスケープしなければ必ず取り除かれる
+	always := "\\"
+	if table {
+		always += "|"
+	}
+	text := func(s, always string) string {
+		return escapeMarkdownText(s, always, escape)
+	}
+	// エスケープするかは前後の文字で決まるので、パースし直したときと同じように隣り合う文字列を結合しておく
+	children := func() string {
+		var c strings.Builder
+		for _, child := range mergeTextElements(e.children) {
+			writeInlineMarkdown(&c, child, escape, table)
+		}
+		return c.String()
+	}
+
+	switch e.kind {
+	case inlineElementKindRoot:
+		b.WriteString(children())
+	case inlineElementKindText:
+		b.WriteString(text(e.s, always))
+	case inlineElementKindBold:
+		b.WriteString("**" + children() + "**")
+	case inlineElementKindItalic:
+		// ***a*** は ** と * の順に分割されるので、強調と隣り合うときは _ で囲む
+		c := children()
+		d := "*"
+		if strings.HasPrefix(c, "*") || strings.HasSuffix(c, "*") || strings.HasSuffix(b.String(), "*") {
+			d = "_"
+		}
+		b.WriteString(d + c + d)
+	case inlineElementKindStrikethrough:
+		b.WriteString("~~" + children() + "~~")
+	case inlineElementKindMark:
+		b.WriteString("==" + children() + "==")
+	case inlineElementKindCode:
+		b.WriteString("`" + text(inlineElementToText(e), always+"`") + "`")
+	case inlineElementKindLink:
+		if len(e.children) == 1 && e.children[0].kind == inlineElementKindText && e.children[0].s == e.linkHref {
+			b.WriteString("<" + text(e.linkHref, always) + ">")
+			return
+		}
+		b.WriteString("[" + children() + "](" + text(e.linkHref, always) + ")")
+	case inlineElementKindFootnoteReference:
+		b.WriteString("[^" + text(e.footnoteLabel, always) + "]")
+	case inlineElementKindRuby:
+		base := inlineElementToText(e)
+		// テーブルの中では {漢字|かんじ} の | がセルの区切りになる
+		if table {
+			b.WriteString("｜" + text(base, always) + "《" + text(e.rubyText, always) + "》")
+			return
+		}
+		b.WriteString("{" + text(base, always) + "|" + text(e.rubyText, always) + "}")
+	case inlineElementKindMath:
+		// 数式の中身はトークンに分割されないので、そのまま書く
+		b.WriteString("$" + e.s + "$")
+	case inlineElementKindHTML:
+		b.WriteString(e.s)
+	default:
+		panic("invalid inlineElementKind")
+	}
+}
+
+// always に含まれる文字と、escape のときは記法として解釈されうる記号の前に \ を付ける
+func escapeMarkdownText(s, always string, escape bool) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if strings.ContainsRune(always, c) || (escape && isMarkdownSpecialCharacter(r, i)) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// r[i] が、前後の文字によっては記法として解釈されうるか。
+// ( や > のように、他の記号と組み合わさったときだけ記法になる文字はエスケープしない
+func isMarkdownSpecialCharacter(r []rune, i int) bool {
+	switch r[i] {
+	case '\\', '*', '`', '[', ']', '<', '{', '}', '|', '$', '｜', '《', '》':
+		return true
+	case '~', '=':
+		// ~~ と == のみが記法になる。文字列の端では、隣の要素と繋がる可能性がある
+		return i == 0 || i == len(r)-1 || r[i-1] == r[i] || r[i+1] == r[i]
+	case '_':
+		// snake_case のような単語中の _ は記法にならない
+		return i == 0 || i == len(r)-1 || !isASCIIAlphanumeric(r[i-1]) || !isASCIIAlphanumeric(r[i+1])
+	}
+	return false
+}
+
+// 段落の行が、見出しやリストなどの行として解釈されないようにする
+func escapeMarkdownLineStart(s string) string {
+	i := len(s) - len(strings.TrimLeft(s, " "))
+	if i == len(s) {
+		return s
+	}
+
+	switch {
+	case strings.ContainsRune("#-!:>", rune(s[i])):
+		return s[:i] + "\\" + s[i:]
+	case '0' <= s[i] && s[i] <= '9':
+		j := i
+		for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+			j++
+		}
+		if j < len(s) && s[j] == '.' {
+			return s[:j] + "\\" + s[j:]
+		}
+	}
+	return s
+}
+
+// 元の文書から決まる部分を比較する。
+// 行番号、見出しの id や脚注の番号のように後から割り当てる値と、インライン要素の文字列の分割のされ方は比較しない。
+func blockElementsEqual(a, b []blockElement) bool {
+	return slices.EqualFunc(a, b, blockElementEqual)
+}
+
+func blockElementEqual(a, b blockElement) bool {
+	return a.kind == b.kind &&
+		inlineElementEqual(a.children, b.children) &&
+		a.listLevel == b.listLevel &&
+		a.listOrdered == b.listOrdered &&
+		a.listStart == b.listStart &&
+		a.imageSrc == b.imageSrc &&
+		a.imageCaption == b.imageCaption &&
+		a.codeInfo.language == b.codeInfo.language &&
+		a.codeInfo.fileName == b.codeInfo.fileName &&
+		slices.Equal(a.codeInfo.highlightLines, b.codeInfo.highlightLines) &&
+		a.codeInfo.showLineNumbers == b.codeInfo.showLineNumbers &&
+		a.codeText == b.codeText &&
+		a.mathText == b.mathText &&
+		a.rawHTML == b.rawHTML &&
+		a.checkboxList == b.checkboxList &&
+		a.checkboxIsChecked == b.checkboxIsChecked &&
+		a.detailsSummary == b.detailsSummary &&
+		a.calloutKind == b.calloutKind &&
+		a.calloutTitle == b.calloutTitle &&
+		blockElementsEqual(a.blocks, b.blocks) &&
+		a.footnoteLabel == b.footnoteLabel &&
+		slices.EqualFunc(a.tableHeader, b.tableHeader, inlineElementEqual) &&
+		slices.Equal(a.tableAlignments, b.tableAlignments) &&
+		slices.EqualFunc(a.tableRows, b.tableRows, func(a, b []inlineElement) bool {
+			return slices.EqualFunc(a, b, inlineElementEqual)
+		})
+}
+
+// 隣り合う文字列は、結合してから比較する
+func inlineElementEqual(a, b inlineElement) bool {
+	return a.kind == b.kind &&
+		a.s == b.s &&
+		a.linkHref == b.linkHref &&
+		a.rubyText == b.rubyText &&
+		a.footnoteLabel == b.footnoteLabel &&
+		slices.EqualFunc(mergeTextElements(a.children), mergeTextElements(b.children), inlineElementEqual)
+}
+
+func mergeTextElements(elements []inlineElement) []inlineElement {
+	var ret []inlineElement
+	for i := 0; i < len(elements); i++ {
+		e := elements[i]
+		if e.kind != inlineElementKindText {
+			ret = append(ret, e)
+			continue
+		}
+		j := i + 1
+		for j < len(elements) && elements[j].kind == inlineElementKindText {
+			j++
+		}
+		if j-i > 1 {
+			var b strings.Builder
+			for _, t := range elements[i:j] {
+				b.WriteString(t.s)
+			}
+			e.s = b.String()
+		}
+		ret = append(ret, e)
+		i = j - 1
+	}
+	return ret
+}
@@ -0,0 +1,136 @@
+package md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		md     string
+		expect string
+	}{
+		// リストのインデントをスペース2つにそろえ、行末の空白と連続する空行を取り除く
+		{"- a  \n    - b\n    - c\n        - d\n- e\n\n\n\ntext\n\n", "- a\n  - b\n  - c\n    - d\n- e\n\ntext\n"},
+		{"<details>\n<summary>要約</summary>\n\n本文\n</details>", ":::details 要約\n本文\n:::\n"},
+		{"```go:main.go  showLineNumbers {3-5,1}\nfunc main() {}\n```", "```go:main.go {3-5,1} showLineNumbers\nfunc main() {}\n```\n"},
+		{"$$x^2$$", "$$\nx^2\n$$\n"},
+		{"> a\n>\n> > b", "> a\n>\n> > b\n"},
+		{"|a|b|\n|:-|-:|\n|1|", "| a | b |\n| :--- | ---: |\n| 1 |  |\n"},
+		{"_a_ ***b*** snake_case", "*a* ***b*** snake_case\n"},
+		// エスケープしないと記法になる文字は、エスケープを残す
+		{"\\- a\n\\*b\\*", "\\- a\n\\*b\\*\n"},
+		{"- \\[x] a", "- \\[x\\] a\n"},
+		{"| `a\\|b` |\n|---|", "| `a\\|b` |\n| --- |\n"},
+		// 文字列が分割されていても、結合したときと同じようにエスケープする
+		{"\\``d_\\c", "\\`\\`d_c\n"},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		got, err := Format(c.md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertSame(t, got, c.expect)
+
+		// 整形済みの文書は変わらない
+		again, _ := Format(got)
+		test.AssertSame(t, again, got)
+	}
+
+	_, err := Format("\xff")
+	test.AssertEquals(t, err, ErrInvalidUTF8)
+
+	// 整形すると意味が変わってしまう部分だけを、元の書き方のまま残す
+	got, err := Format("- a\n    - b\n\n\n0*0***  \n\ntext  ")
+	test.AssertSame(t, got, "- a\n  - b\n\n0*0***  \n\ntext\n")
+	test.AssertEquals(t, err, error(&FormatError{Lines: []int{5}}))
+}
+
+func TestFormatNestedDetails(t *testing.T) {
+	// 入れ子が深くても、深さに対して指数的に遅くならない
+	const depth = 40
+	md := strings.Repeat(":::details a\n", depth) + "text\n" + strings.Repeat(":::\n", depth)
+
+	start := time.Now()
+	got, err := Format(md)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Format took %v for %d nested :::details", elapsed, depth)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertSame(t, got, md)
+}
+
+func FuzzFormat(f *testing.F) {
+	f.Add("- a  \n    - b\n\n\n\ntext\n\n")
+	f.Add("\\``d_\\c")
+	f.Add("0*0***\n\n> a\n>\n> > b")
+	f.Add("| `a\\|b` |\n|---|\n| {漢字|かんじ} |")
+	f.Fuzz(func(t *testing.T, md string) {
+		s, err := Format(md)
+		if err == ErrInvalidUTF8 {
+			return
+		}
+		if _, ok := err.(*FormatError); err != nil && !ok {
+			t.Fatal(err)
+		}
+
+		// 整形しても意味は変わらず、整形済みの文書は変わらない
+		if !blockElementsEqual(normalizeBlockElements(parseBlock(s)), normalizeBlockElements(parseBlock(md))) {
+			t.Fatalf("meaning changed\nmarkdown:  %q\nformatted: %q", md, s)
+		}
+		again, _ := Format(s)
+		if again != s {
+			t.Fatalf("not idempotent\nmarkdown: %q\nonce:     %q\ntwice:    %q", md, s, again)
+		}
+	})
+}
+
+// testdata/roundtrip の文書と全ての記法を含む文書を、Markdown に戻してからパースし直しても同じ要素になることを確かめる
+func TestMarkdownRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/roundtrip/*.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpus := map[string]string{"benchmarkDocument": benchmarkDocument(1)}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus[f] = string(b)
+	}
+
+	for name, md := range corpus {
+		elements := parseBlock(md)
+		s, ok := blockElementsToMarkdown(elements)
+		if !ok || !blockElementsEqual(parseBlock(s), elements) {
+			t.Errorf("round trip failed: %s\nprinted: %q", name, s)
+			continue
+		}
+
+		d, err := Parse(md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		if err := (MarkdownRenderer{}).Render(&b, d); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		d2, err := Parse(b.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blockElementsEqual(nodesToBlockElements(d2.Children), nodesToBlockElements(d.Children)) {
+			t.Errorf("round trip of Document failed: %s\nprinted: %q", name, b.String())
+		}
+	}
+}
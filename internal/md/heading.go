@@ -0,0 +1,139 @@
+package md
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 文書中の見出し
+type Heading struct {
+	// 1 から 6
+	Level int
+	// 見出しに付与される id 属性
+	ID string
+	// マークアップを除いた見出しの文字列
+	Text string
+}
+
+// 文書中の見出しの一覧を出現順に返す。
+// :::details や引用の中の見出しは含まない。
+func Headings(md string) []Heading {
+	elements := parseBlock(md)
+	assignHeadingIDs(elements)
+	return headingsFromBlockElements(elements)
+}
+
+func headingLevel(kind blockElementKind) int {
+	switch kind {
+	case blockElementKindHeading1:
+		return 1
+	case blockElementKindHeading2:
+		return 2
+	case blockElementKindHeading3:
+		return 3
+	case blockElementKindHeading4:
+		return 4
+	case blockElementKindHeading5:
+		return 5
+	case blockElementKindHeading6:
+		return 6
+	}
+	return 0
+}
+
+// 見出しに id を割り当てる。同じ id が既にあれば、末尾に -1, -2, ... を付与して重複を避ける。
+// :::details や引用の中の見出しにも、文書全体で重複しないように id を割り当てる。
+// 脚注の id (fn-1, fnref-1) と重ならないよう、fn- と fnref- で始まる id には section- を付ける。
+func assignHeadingIDs(elements []blockElement) {
+	assignHeadingIDsWithUsed(elements, make(map[string]bool), make(map[string]int))
+}
+
+// next は、同じ見出しに次に試す番号。同じ見出しが多いときに、使用済みの番号を毎回数え直さないようにする
+func assignHeadingIDsWithUsed(elements []blockElement, used map[string]bool, next map[string]int) {
+	for i := range elements {
+		assignHeadingIDsWithUsed(elements[i].blocks, used, next)
+
+		if headingLevel(elements[i].kind) == 0 {
+			continue
+		}
+
+		base := slugify(inlineElementToText(elements[i].children))
+		if strings.HasPrefix(base, "fn-") || strings.HasPrefix(base, "fnref-") {
+			base = "section-" + base
+		}
+		id := base
+		n := max(next[base], 1)
+		for used[id] {
+			id = base + "-" + strconv.Itoa(n)
+			n++
+		}
+		next[base] = n
+		used[id] = true
+
+		elements[i].headingID = id
+	}
+}
+
+func headingsFromBlockElements(elements []blockElement) []Heading {
+	var ret []Heading
+	for _, e := range elements {
+		level := headingLevel(e.kind)
+		if level == 0 || e.headingID == "" {
+			continue
+		}
+		ret = append(ret, Heading{
+			Level: level,
+			ID:    e.headingID,
+			Text:  inlineElementToText(e.children),
+		})
+	}
+	return ret
+}
+
+// 見出しの文字列から id を生成する。
+// 日本語などの文字はそのまま残し、空白は - に、記号は取り除く。
+func slugify(s string) string {
+	var b strings.Builder
+	previousHyphen := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_':
+			b.WriteRune(r)
+			previousHyphen = false
+		case unicode.IsSpace(r) || r == '-':
+			if !previousHyphen {
+				b.WriteRune('-')
+			}
+			previousHyphen = true
+		}
+	}
+
+	ret := strings.Trim(b.String(), "-")
+	if ret == "" {
+		return "section"
+	}
+	return ret
+}
+
+// インライン要素からマークアップを除いた文字列を取り出す
+func inlineElementToText(tree inlineElement) string {
+	if tree.kind == inlineElementKindText {
+		return tree.s
+	}
+
+	var b strings.Builder
+	writeInlineElementText(&b, tree)
+	return b.String()
+}
+
+func writeInlineElementText(b *strings.Builder, tree inlineElement) {
+	if tree.kind == inlineElementKindText {
+		b.WriteString(tree.s)
+		return
+	}
+	for _, c := range tree.children {
+		writeInlineElementText(b, c)
+	}
+}
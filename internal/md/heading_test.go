@@ -0,0 +1,48 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestSlugify(t *testing.T) {
+	test.AssertSame(t, slugify("Hello, World!"), "hello-world")
+	test.AssertSame(t, slugify("  spaces   and - hyphens  "), "spaces-and-hyphens")
+	test.AssertSame(t, slugify("日本語の見出し「かっこ」"), "日本語の見出しかっこ")
+	test.AssertSame(t, slugify("snake_case 123"), "snake_case-123")
+	test.AssertSame(t, slugify("!!!"), "section")
+}
+
+func TestHeadings(t *testing.T) {
+	got := Headings(`# Title
+## **Bold** heading
+### 日本語
+## Bold heading
+text
+
+## !!!
+## fn 1
+## fnref-1`)
+	expect := []Heading{
+		{Level: 1, ID: "title", Text: "Title"},
+		{Level: 2, ID: "bold-heading", Text: "Bold heading"},
+		{Level: 3, ID: "日本語", Text: "日本語"},
+		{Level: 2, ID: "bold-heading-1", Text: "Bold heading"},
+		{Level: 2, ID: "section", Text: "!!!"},
+		// 脚注の id と重ならない
+		{Level: 2, ID: "section-fn-1", Text: "fn 1"},
+		{Level: 2, ID: "section-fnref-1", Text: "fnref-1"},
+	}
+	test.AssertEquals(t, got, expect)
+}
+
+func TestToHTMLWithTOC(t *testing.T) {
+	got := ToHTML(`[[toc]]
+## A
+### B
+## A`)
+	expect := "<nav class=\"toc\"><ul><li><a href=\"#a\">A</a></li><ul><li><a href=\"#b\">B</a></li></ul><li><a href=\"#a-1\">A</a></li></ul></nav>" +
+		"<h2 id=\"a\">A</h2><h3 id=\"b\">B</h3><h2 id=\"a-1\">A</h2>"
+	test.AssertSame(t, got, expect)
+}
@@ -0,0 +1,460 @@
+package md
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+type highlightToken struct {
+	// 空文字列のときは装飾しない
+	class string
+	s     string
+}
+
+const (
+	highlightClassKeyword  = "hl-keyword"
+	highlightClassLiteral  = "hl-literal"
+	highlightClassString   = "hl-string"
+	highlightClassNumber   = "hl-number"
+	highlightClassComment  = "hl-comment"
+	highlightClassKey      = "hl-key"
+	highlightClassVariable = "hl-variable"
+	highlightClassTag      = "hl-tag"
+	highlightClassAttr     = "hl-attr"
+)
+
+type highlightLanguage struct {
+	keywords map[string]bool
+	literals map[string]bool
+	// SQL のように、キーワードの大文字と小文字を区別しない
+	caseInsensitive bool
+	lineComments    []string
+	blockComments   [][2]string
+	quotes          string
+	// 改行をまたぐことができる文字列のクォート
+	multilineQuotes string
+	// 識別子として扱う英数字と _ 以外の文字
+	identExtra string
+	// 行コメントの直前に行頭か空白を要求する (URL 中の # をコメントとして扱わないため)
+	commentNeedsSpace bool
+	// "key": のような文字列をキーとして扱う
+	stringKeys bool
+	// key: のような行頭の語をキーとして扱う
+	yamlKeys bool
+	// $VAR や ${VAR} を変数として扱う
+	shellVariables bool
+}
+
+func words(s string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		ret[w] = true
+	}
+	return ret
+}
+
+var (
+	highlightGo = highlightLanguage{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var`),
+		literals:        words("true false nil iota"),
+		lineComments:    []string{"//"},
+		blockComments:   [][2]string{{"/*", "*/"}},
+		quotes:          `"'`,
+		multilineQuotes: "`",
+	}
+
+	jsKeywords = `async await break case catch class const continue debugger default delete do else export
+		extends finally for from function if import in instanceof let new of return static super switch
+		this throw try typeof var void while with yield`
+
+	highlightJS = highlightLanguage{
+		keywords:        words(jsKeywords),
+		literals:        words("true false null undefined NaN Infinity"),
+		lineComments:    []string{"//"},
+		blockComments:   [][2]string{{"/*", "*/"}},
+		quotes:          `"'`,
+		multilineQuotes: "`",
+		identExtra:      "$",
+	}
+
+	highlightTS = highlightLanguage{
+		keywords: words(jsKeywords + ` abstract as declare enum implements interface keyof namespace
+			private protected public readonly type any boolean number string symbol unknown never`),
+		literals:        words("true false null undefined NaN Infinity"),
+		lineComments:    []string{"//"},
+		blockComments:   [][2]string{{"/*", "*/"}},
+		quotes:          `"'`,
+		multilineQuotes: "`",
+		identExtra:      "$",
+	}
+
+	highlightSQL = highlightLanguage{
+		keywords: words(`add all alter and as asc auto_increment begin between by case check column commit
+			constraint create cross database default delete desc distinct drop else end exists foreign from
+			full group having if in index inner insert into is join key left like limit not offset on or
+			order outer primary references rename replace right rollback select set table then transaction
+			truncate union unique update using values view when where with
+			bigint binary blob boolean char date datetime decimal double float int integer json text
+			timestamp tinyint unsigned varbinary varchar`),
+		literals:        words("null true false"),
+		caseInsensitive: true,
+		lineComments:    []string{"--", "#"},
+		blockComments:   [][2]string{{"/*", "*/"}},
+		quotes:          "'\"`",
+	}
+
+	highlightShell = highlightLanguage{
+		keywords: words(`if then else elif fi for while until do done case esac in function return exit
+			export local readonly source alias unset shift break continue`),
+		literals:          words("true false"),
+		lineComments:      []string{"#"},
+		commentNeedsSpace: true,
+		quotes:            `"'`,
+		shellVariables:    true,
+	}
+
+	highlightJSON = highlightLanguage{
+		literals:   words("true false null"),
+		quotes:     `"`,
+		stringKeys: true,
+	}
+
+	highlightYAML = highlightLanguage{
+		literals:          words("true false null yes no on off"),
+		lineComments:      []string{"#"},
+		commentNeedsSpace: true,
+		quotes:            `"'`,
+		stringKeys:        true,
+		yamlKeys:          true,
+	}
+)
+
+// コードブロックの言語名に対応するハイライタでトークンに分割する。
+// 対応していない言語のときは false を返す。
+func highlight(lang, code string) ([]highlightToken, bool) {
+	switch strings.ToLower(lang) {
+	case "go", "golang":
+		return highlightWithLanguage(highlightGo, code), true
+	case "js", "javascript", "jsx", "mjs", "cjs":
+		return highlightWithLanguage(highlightJS, code), true
+	case "ts", "typescript", "tsx":
+		return highlightWithLanguage(highlightTS, code), true
+	case "sql", "mysql":
+		return highlightWithLanguage(highlightSQL, code), true
+	case "sh", "shell", "bash", "zsh":
+		return highlightWithLanguage(highlightShell, code), true
+	case "json":
+		return highlightWithLanguage(highlightJSON, code), true
+	case "yaml", "yml":
+		return highlightWithLanguage(highlightYAML, code), true
+	case "html", "xml", "svg":
+		return highlightHTML(code), true
+	}
+	return nil, false
+}
+
+func writeHighlightTokensHTML(w *htmlWriter, tokens []highlightToken) {
+	for _, t := range tokens {
+		if t.class == "" {
+			w.WriteString(html.EscapeString(t.s))
+			continue
+		}
+		w.WriteString("<span class=\"" + t.class + "\">" + html.EscapeString(t.s) + "</span>")
+	}
+}
+
+func hasPrefixAt(s []rune, i int, prefix string) bool {
+	for _, r := range prefix {
+		if i >= len(s) || s[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// s[i:] から r が最初に現れる位置を返す。見つからなければ len(s) を返す。
+func indexRuneFrom(s []rune, i int, r rune) int {
+	for ; i < len(s); i++ {
+		if s[i] == r {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func highlightWithLanguage(lang highlightLanguage, code string) []highlightToken {
+	var ret []highlightToken
+	var plain strings.Builder
+
+	// capture ret, plain
+	flush := func() {
+		if plain.Len() > 0 {
+			ret = append(ret, highlightToken{s: plain.String()})
+			plain.Reset()
+		}
+	}
+	emit := func(class string, s []rune) {
+		flush()
+		ret = append(ret, highlightToken{class: class, s: string(s)})
+	}
+
+	isIdent := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || strings.ContainsRune(lang.identExtra, r)
+	}
+
+	s := []rune(code)
+	// 行頭からインデントとリストの - しか現れていない
+	lineStart := true
+
+scan:
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c == '\n' {
+			lineStart = true
+			plain.WriteString("\n")
+			i++
+			continue
+		}
+		if c == ' ' || c == '\t' {
+			plain.WriteRune(c)
+			i++
+			continue
+		}
+		if lang.yamlKeys && lineStart && c == '-' && (i+1 == len(s) || s[i+1] == ' ') {
+			plain.WriteString("-")
+			i++
+			continue
+		}
+
+		wasLineStart := lineStart
+		lineStart = false
+
+		for _, bc := range lang.blockComments {
+			if !hasPrefixAt(s, i, bc[0]) {
+				continue
+			}
+			j := i + len([]rune(bc[0]))
+			for j < len(s) && !hasPrefixAt(s, j, bc[1]) {
+				j++
+			}
+			j = min(j+len([]rune(bc[1])), len(s))
+			emit(highlightClassComment, s[i:j])
+			i = j
+			continue scan
+		}
+
+		for _, lc := range lang.lineComments {
+			if !hasPrefixAt(s, i, lc) {
+				continue
+			}
+			if lang.commentNeedsSpace && i > 0 && !unicode.IsSpace(s[i-1]) {
+				continue
+			}
+			j := indexRuneFrom(s, i, '\n')
+			emit(highlightClassComment, s[i:j])
+			i = j
+			continue scan
+		}
+
+		if lang.yamlKeys && wasLineStart && !strings.ContainsRune(lang.quotes+"#{[", c) {
+			// 同じ行の中で、後ろに空白か行末が続く : を探す
+			end := indexRuneFrom(s, i, '\n')
+			for j := i; j < end; j++ {
+				if s[j] == '#' {
+					break
+				}
+				if s[j] == ':' && (j+1 == end || s[j+1] == ' ') {
+					emit(highlightClassKey, s[i:j])
+					i = j
+					continue scan
+				}
+			}
+		}
+
+		if strings.ContainsRune(lang.quotes+lang.multilineQuotes, c) {
+			multiline := strings.ContainsRune(lang.multilineQuotes, c)
+			j := i + 1
+			for j < len(s) {
+				if s[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if s[j] == c {
+					j++
+					break
+				}
+				if s[j] == '\n' && !multiline {
+					break
+				}
+				j++
+			}
+			j = min(j, len(s))
+
+			class := highlightClassString
+			if lang.stringKeys {
+				k := j
+				for k < len(s) && (s[k] == ' ' || s[k] == '\t') {
+					k++
+				}
+				if k < len(s) && s[k] == ':' {
+					class = highlightClassKey
+				}
+			}
+			emit(class, s[i:j])
+			i = j
+			continue
+		}
+
+		if lang.shellVariables && c == '$' && i+1 < len(s) {
+			j := i + 1
+			switch {
+			case s[j] == '{':
+				j = min(indexRuneFrom(s, j, '}')+1, len(s))
+			case strings.ContainsRune("@#?$!*-", s[j]) || unicode.IsDigit(s[j]):
+				j++
+			default:
+				for j < len(s) && isIdent(s[j]) {
+					j++
+				}
+			}
+			if j > i+1 {
+				emit(highlightClassVariable, s[i:j])
+				i = j
+				continue
+			}
+		}
+
+		if unicode.IsDigit(c) && (i == 0 || !isIdent(s[i-1])) {
+			j := i
+			for j < len(s) && (isIdent(s[j]) || s[j] == '.') {
+				j++
+			}
+			emit(highlightClassNumber, s[i:j])
+			i = j
+			continue
+		}
+
+		if isIdent(c) {
+			j := i
+			for j < len(s) && isIdent(s[j]) {
+				j++
+			}
+
+			w := string(s[i:j])
+			if lang.caseInsensitive {
+				w = strings.ToLower(w)
+			}
+
+			switch {
+			case lang.keywords[w]:
+				emit(highlightClassKeyword, s[i:j])
+			case lang.literals[w]:
+				emit(highlightClassLiteral, s[i:j])
+			default:
+				plain.WriteString(string(s[i:j]))
+			}
+			i = j
+			continue
+		}
+
+		plain.WriteRune(c)
+		i++
+	}
+
+	flush()
+	return ret
+}
+
+func highlightHTML(code string) []highlightToken {
+	var ret []highlightToken
+	var plain strings.Builder
+
+	// capture ret, plain
+	flush := func() {
+		if plain.Len() > 0 {
+			ret = append(ret, highlightToken{s: plain.String()})
+			plain.Reset()
+		}
+	}
+	emit := func(class string, s []rune) {
+		flush()
+		ret = append(ret, highlightToken{class: class, s: string(s)})
+	}
+
+	isName := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == ':' || r == '!' || r == '?'
+	}
+
+	s := []rune(code)
+	for i := 0; i < len(s); {
+		if hasPrefixAt(s, i, "<!--") {
+			j := i + 4
+			for j < len(s) && !hasPrefixAt(s, j, "-->") {
+				j++
+			}
+			j = min(j+3, len(s))
+			emit(highlightClassComment, s[i:j])
+			i = j
+			continue
+		}
+
+		if s[i] != '<' || i+1 >= len(s) || !(isName(s[i+1]) || s[i+1] == '/') {
+			plain.WriteRune(s[i])
+			i++
+			continue
+		}
+
+		// タグの開始
+		plain.WriteString("<")
+		i++
+		if s[i] == '/' {
+			plain.WriteString("/")
+			i++
+		}
+		j := i
+		for j < len(s) && isName(s[j]) {
+			j++
+		}
+		emit(highlightClassTag, s[i:j])
+		i = j
+
+		// 属性
+		for i < len(s) && s[i] != '>' {
+			c := s[i]
+			switch {
+			case c == '"' || c == '\'':
+				j := min(indexRuneFrom(s, i+1, c)+1, len(s))
+				emit(highlightClassString, s[i:j])
+				i = j
+			case unicode.IsSpace(c) || c == '=' || c == '/':
+				plain.WriteRune(c)
+				i++
+			case i > 0 && s[i-1] == '=':
+				j := i
+				for j < len(s) && !unicode.IsSpace(s[j]) && s[j] != '>' {
+					j++
+				}
+				emit(highlightClassString, s[i:j])
+				i = j
+			default:
+				j := i
+				for j < len(s) && !unicode.IsSpace(s[j]) && !strings.ContainsRune("=>/\"'", s[j]) {
+					j++
+				}
+				emit(highlightClassAttr, s[i:j])
+				i = j
+			}
+		}
+		if i < len(s) {
+			plain.WriteString(">")
+			i++
+		}
+	}
+
+	flush()
+	return ret
+}
@@ -0,0 +1,138 @@
+package md
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestHighlight(t *testing.T) {
+	var got []highlightToken
+	var expect []highlightToken
+	var ok bool
+
+	// 対応していない言語
+	_, ok = highlight("brainfuck", "+++")
+	test.AssertSame(t, ok, false)
+
+	// Go
+	got, ok = highlight("go", "func f() string { return \"a\\\"b\" } // c\n/* d */ x := 0x1f")
+	expect = []highlightToken{
+		{class: highlightClassKeyword, s: "func"},
+		{s: " f() string { "},
+		{class: highlightClassKeyword, s: "return"},
+		{s: " "},
+		{class: highlightClassString, s: "\"a\\\"b\""},
+		{s: " } "},
+		{class: highlightClassComment, s: "// c"},
+		{s: "\n"},
+		{class: highlightClassComment, s: "/* d */"},
+		{s: " x := "},
+		{class: highlightClassNumber, s: "0x1f"},
+	}
+	test.AssertSame(t, ok, true)
+	test.AssertEquals(t, got, expect)
+
+	// JavaScript のテンプレートリテラルは改行をまたぐ
+	got, _ = highlight("js", "const $a = `x\ny`;")
+	expect = []highlightToken{
+		{class: highlightClassKeyword, s: "const"},
+		{s: " $a = "},
+		{class: highlightClassString, s: "`x\ny`"},
+		{s: ";"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// TypeScript
+	got, _ = highlight("ts", "let a: number = null")
+	expect = []highlightToken{
+		{class: highlightClassKeyword, s: "let"},
+		{s: " a: "},
+		{class: highlightClassKeyword, s: "number"},
+		{s: " = "},
+		{class: highlightClassLiteral, s: "null"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// SQL のキーワードは大文字と小文字を区別しない
+	got, _ = highlight("sql", "SELECT id from t -- c")
+	expect = []highlightToken{
+		{class: highlightClassKeyword, s: "SELECT"},
+		{s: " id "},
+		{class: highlightClassKeyword, s: "from"},
+		{s: " t "},
+		{class: highlightClassComment, s: "-- c"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// シェル
+	got, _ = highlight("sh", "echo ${HOME} $1 a#b # c")
+	expect = []highlightToken{
+		{s: "echo "},
+		{class: highlightClassVariable, s: "${HOME}"},
+		{s: " "},
+		{class: highlightClassVariable, s: "$1"},
+		{s: " a#b "},
+		{class: highlightClassComment, s: "# c"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// JSON
+	got, _ = highlight("json", `{"a": [1, true]}`)
+	expect = []highlightToken{
+		{s: "{"},
+		{class: highlightClassKey, s: `"a"`},
+		{s: ": ["},
+		{class: highlightClassNumber, s: "1"},
+		{s: ", "},
+		{class: highlightClassLiteral, s: "true"},
+		{s: "]}"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// YAML
+	got, _ = highlight("yaml", "key: 'v' # c\n- name: https://example.com/#a\n")
+	expect = []highlightToken{
+		{class: highlightClassKey, s: "key"},
+		{s: ": "},
+		{class: highlightClassString, s: "'v'"},
+		{s: " "},
+		{class: highlightClassComment, s: "# c"},
+		{s: "\n- "},
+		{class: highlightClassKey, s: "name"},
+		{s: ": https://example.com/#a\n"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// HTML
+	got, _ = highlight("html", `<a href="/">x</a><!-- c -->`)
+	expect = []highlightToken{
+		{s: "<"},
+		{class: highlightClassTag, s: "a"},
+		{s: " "},
+		{class: highlightClassAttr, s: "href"},
+		{s: "="},
+		{class: highlightClassString, s: `"/"`},
+		{s: ">x</"},
+		{class: highlightClassTag, s: "a"},
+		{s: ">"},
+		{class: highlightClassComment, s: "<!-- c -->"},
+	}
+	test.AssertEquals(t, got, expect)
+}
+
+func highlightTokensToHTML(tokens []highlightToken) string {
+	var b strings.Builder
+	writeHighlightTokensHTML(&htmlWriter{StringWriter: &b}, tokens)
+	return b.String()
+}
+
+func TestHighlightTokensToHTML(t *testing.T) {
+	got := highlightTokensToHTML([]highlightToken{
+		{s: "<"},
+		{class: highlightClassTag, s: "a"},
+		{s: ">"},
+	})
+	test.AssertSame(t, got, "&lt;<span class=\"hl-tag\">a</span>&gt;")
+}
@@ -3,101 +3,369 @@ package md
 import (
 	"fmt"
 	"html"
+	"io"
+	"strconv"
+	"strings"
 )
 
+// HTML の書き込み先と、出力の設定
+type htmlWriter struct {
+	io.StringWriter
+	options Options
+	// HTML のブロックと、段落などの中の HTML のタグ。閉じられていないタグは、それぞれの範囲の終わりで閉じる
+	blockHTML, inlineHTML *htmlSanitizer
+}
+
+// ブロック要素の開始タグに付ける data-source-line 属性。出力しない設定のときは空文字列
+func (w *htmlWriter) sourceLineAttr(e blockElement) string {
+	if !w.options.SourceLine || e.line == 0 {
+		return ""
+	}
+	return " data-source-line=\"" + strconv.Itoa(e.line) + "\""
+}
+
+// 本文と、末尾の脚注を出力する
+func writeDocumentHTML(w *htmlWriter, elements []blockElement) {
+	footnotes := resolveFootnotes(elements)
+	writeBlockElementsHTML(w, elements)
+	writeFootnotesHTML(w, footnotes)
+}
+
 func blockElementsToHTML(elements []blockElement) string {
-	ret := ""
+	var b strings.Builder
+	writeBlockElementsHTML(&htmlWriter{StringWriter: &b}, elements)
+	return b.String()
+}
+
+func writeBlockElementsHTML(w *htmlWriter, elements []blockElement) {
+	outer := w.blockHTML
+	w.blockHTML = &htmlSanitizer{}
+	defer func() {
+		w.blockHTML.close(w)
+		w.blockHTML = outer
+	}()
 
 	previousListLevel := 0
+	// 各階層で開いているリストのタグ (ul または ol)
+	var listTags []string
+	closeList := func() {
+		previousListLevel--
+		w.WriteString("</" + listTags[len(listTags)-1] + ">")
+		listTags = listTags[:len(listTags)-1]
+	}
+
 	for i := range len(elements) {
 		if elements[i].kind != blockElementKindList {
 			for previousListLevel > 0 {
-				previousListLevel--
-				ret += "</ul>"
+				closeList()
 			}
 		}
 
-		c := inlineElementToHTML(elements[i].children)
+		if render := blockRenderer(elements[i].kind); render != nil {
+			render(w, elements[i])
+			continue
+		}
+
+		attr := w.sourceLineAttr(elements[i])
 
 		switch elements[i].kind {
 		case blockElementKindParagraph:
-			ret += "<p>" + c + "</p>"
+			w.WriteString("<p" + attr + ">")
+			writeInlineElementHTML(w, elements[i].children)
+			w.WriteString("</p>")
 		case blockElementKindList:
-			liStart := "<li>"
+			liStart := "<li" + attr + ">"
 			if elements[i].checkboxList && elements[i].checkboxIsChecked {
-				liStart = "<li><input type='checkbox' checked inert>"
+				liStart += "<input type='checkbox' checked inert>"
 			}
 			if elements[i].checkboxList && !elements[i].checkboxIsChecked {
-				liStart = "<li><input type='checkbox' inert>"
+				liStart += "<input type='checkbox' inert>"
+			}
+
+			tag := "ul"
+			listStart := "<ul>"
+			if elements[i].listOrdered {
+				tag = "ol"
+				listStart = "<ol>"
+				if elements[i].listStart != 1 {
+					listStart = fmt.Sprintf("<ol start=\"%d\">", elements[i].listStart)
+				}
 			}
 
-			if previousListLevel == elements[i].listLevel {
-				ret += liStart + c + "</li>"
-			} else if previousListLevel < elements[i].listLevel {
+			for previousListLevel > elements[i].listLevel {
+				closeList()
+			}
+			// 同じ階層で ul と ol が切り替わったときは、リストを閉じて開き直す
+			if previousListLevel == elements[i].listLevel && listTags[len(listTags)-1] != tag {
+				closeList()
+			}
+			if previousListLevel < elements[i].listLevel {
 				previousListLevel++
-				ret += "<ul>" + liStart + c + "</li>"
+				listTags = append(listTags, tag)
+				w.WriteString(listStart)
+			}
+			w.WriteString(liStart)
+			writeInlineElementHTML(w, elements[i].children)
+			w.WriteString("</li>")
+		case blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+			blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6:
+			tag := "h" + strconv.Itoa(headingLevel(elements[i].kind))
+			if elements[i].headingID == "" {
+				w.WriteString("<" + tag + attr + ">")
 			} else {
-				for previousListLevel > elements[i].listLevel {
-					previousListLevel--
-					ret += "</ul>"
-				}
-				ret += liStart + c + "</li>"
+				w.WriteString("<" + tag + " id=\"" + html.EscapeString(elements[i].headingID) + "\"" + attr + ">")
 			}
-		case blockElementKindImage:
-			ret += fmt.Sprintf(
-				"<figure><img src=\"%s\" alt=\"%s\"><figcaption>%s</figcaption></figure>",
-				html.EscapeString(elements[i].imageSrc),
-				html.EscapeString(elements[i].imageCaption),
-				html.EscapeString(elements[i].imageCaption),
-			)
-		case blockElementKindHeading1:
-			ret += "<h1>" + c + "</h1>"
-		case blockElementKindHeading2:
-			ret += "<h2>" + c + "</h2>"
-		case blockElementKindHeading3:
-			ret += "<h3>" + c + "</h3>"
+			writeInlineElementHTML(w, elements[i].children)
+			w.WriteString("</" + tag + ">")
+		case blockElementKindTOC:
+			writeTOCHTML(w, headingsFromBlockElements(elements), attr)
 		case blockElementKindCodeBlock:
-			ret += "<pre><code>" + html.EscapeString(elements[i].codeText) + "</code></pre>"
+			writeCodeBlockHTML(w, elements[i])
 		case blockElementKindEmpty:
 			// 空行が挟まれたとき、リストを分割できるようにするための疑似要素
 			// 実際には何も出力しない
-		case blockElementDetails:
-			detailsSummary := elements[i].detailsSummary
-			if detailsSummary == "" {
-				detailsSummary = "詳細"
-			}
-			ret += fmt.Sprintf("<details><summary>%s</summary>%s</details>", html.EscapeString(detailsSummary), elements[i].detailsContentHTML)
+		case blockElementKindBlockquote:
+			w.WriteString("<blockquote" + attr + ">")
+			writeBlockElementsHTML(w, elements[i].blocks)
+			w.WriteString("</blockquote>")
+		case blockElementKindFootnoteDefinition:
+			// 脚注は文書の末尾にまとめて出力する
+		case blockElementKindMath:
+			w.WriteString(strings.Replace(latexToMathML(elements[i].mathText, true), "<math", "<math"+attr, 1))
+		case blockElementKindTable:
+			writeTableHTML(w, elements[i])
 		default:
 			panic("invalid blockElementKind")
 		}
 	}
 
 	for previousListLevel > 0 {
-		previousListLevel--
-		ret += "</ul>"
+		closeList()
+	}
+}
+
+func writeCodeBlockHTML(w *htmlWriter, e blockElement) {
+	info := e.codeInfo
+	attr := w.sourceLineAttr(e)
+
+	if render, ok := diagramRenderers[info.language]; ok {
+		if svg, err := render(e.codeText); err == nil {
+			w.WriteString("<figure class=\"diagram\"" + attr + ">" + svg)
+			if info.fileName != "" {
+				w.WriteString("<figcaption>" + html.EscapeString(info.fileName) + "</figcaption>")
+			}
+			w.WriteString("</figure>")
+			return
+		}
+	}
+
+	tokens, ok := highlight(info.language, e.codeText)
+	if !ok {
+		tokens = []highlightToken{{s: e.codeText}}
+	}
+
+	// ファイル名があるときは、外側の figure に属性を付ける
+	preAttr := attr
+	if info.fileName != "" {
+		w.WriteString("<figure class=\"code-block\"" + attr + "><figcaption>" + html.EscapeString(info.fileName) + "</figcaption>")
+		preAttr = ""
+	}
+
+	if info.language != "" {
+		w.WriteString("<pre" + preAttr + "><code class=\"language-" + html.EscapeString(info.language) + "\">")
+	} else {
+		w.WriteString("<pre" + preAttr + "><code>")
+	}
+
+	if len(info.highlightLines) > 0 || info.showLineNumbers {
+		for i, line := range splitHighlightTokensByLine(tokens) {
+			n := i + 1
+			class := "line"
+			if isHighlightedLine(info.highlightLines, n) {
+				class += " line-highlighted"
+			}
+
+			if i > 0 {
+				w.WriteString("\n")
+			}
+			w.WriteString("<span class=\"" + class + "\">")
+			if info.showLineNumbers {
+				w.WriteString("<span class=\"line-number\">" + strconv.Itoa(n) + "</span>")
+			}
+			writeHighlightTokensHTML(w, line)
+			w.WriteString("</span>")
+		}
+	} else {
+		writeHighlightTokensHTML(w, tokens)
+	}
+
+	w.WriteString("</code></pre>")
+	if info.fileName != "" {
+		w.WriteString("</figure>")
 	}
+}
 
+// 行ごとにマークアップできるよう、改行をまたぐトークンを分割して行ごとに返す
+func splitHighlightTokensByLine(tokens []highlightToken) [][]highlightToken {
+	ret := [][]highlightToken{nil}
+	for _, t := range tokens {
+		for i, s := range strings.Split(t.s, "\n") {
+			if i > 0 {
+				ret = append(ret, nil)
+			}
+			if s == "" {
+				continue
+			}
+			ret[len(ret)-1] = append(ret[len(ret)-1], highlightToken{class: t.class, s: s})
+		}
+	}
 	return ret
 }
 
+func isHighlightedLine(ranges [][2]int, n int) bool {
+	for _, r := range ranges {
+		if r[0] <= n && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTableHTML(w *htmlWriter, e blockElement) {
+	cell := func(tag string, col int, c inlineElement) {
+		style := ""
+		switch e.tableAlignments[col] {
+		case tableAlignmentLeft:
+			style = " style=\"text-align: left\""
+		case tableAlignmentCenter:
+			style = " style=\"text-align: center\""
+		case tableAlignmentRight:
+			style = " style=\"text-align: right\""
+		}
+		w.WriteString("<" + tag + style + ">")
+		writeInlineElementHTML(w, c)
+		w.WriteString("</" + tag + ">")
+	}
+
+	w.WriteString("<table" + w.sourceLineAttr(e) + "><thead><tr>")
+	for i, c := range e.tableHeader {
+		cell("th", i, c)
+	}
+	w.WriteString("</tr></thead>")
+
+	if len(e.tableRows) > 0 {
+		w.WriteString("<tbody>")
+		for _, row := range e.tableRows {
+			w.WriteString("<tr>")
+			for i, c := range row {
+				cell("td", i, c)
+			}
+			w.WriteString("</tr>")
+		}
+		w.WriteString("</tbody>")
+	}
+
+	w.WriteString("</table>")
+}
+
+func writeTOCHTML(w *htmlWriter, headings []Heading, attr string) {
+	if len(headings) == 0 {
+		return
+	}
+
+	// 文書中で最も浅い見出しを 1 階層目とする
+	minLevel := headings[0].Level
+	for _, h := range headings {
+		minLevel = min(minLevel, h.Level)
+	}
+
+	w.WriteString("<nav class=\"toc\"" + attr + ">")
+	previousLevel := 0
+	for _, h := range headings {
+		level := h.Level - minLevel + 1
+		for previousLevel < level {
+			previousLevel++
+			w.WriteString("<ul>")
+		}
+		for previousLevel > level {
+			previousLevel--
+			w.WriteString("</ul>")
+		}
+		w.WriteString("<li><a href=\"#" + html.EscapeString(h.ID) + "\">" + html.EscapeString(h.Text) + "</a></li>")
+	}
+	for previousLevel > 0 {
+		previousLevel--
+		w.WriteString("</ul>")
+	}
+	w.WriteString("</nav>")
+}
+
 func inlineElementToHTML(tree inlineElement) string {
-	c := ""
-	for _, v := range tree.children {
-		c += inlineElementToHTML(v)
+	var b strings.Builder
+	writeInlineElementHTML(&htmlWriter{StringWriter: &b}, tree)
+	return b.String()
+}
+
+func writeInlineElementHTML(w *htmlWriter, tree inlineElement) {
+	if render := inlineRenderer(tree.kind); render != nil {
+		render(w, tree)
+		return
+	}
+
+	children := func() {
+		for _, v := range tree.children {
+			writeInlineElementHTML(w, v)
+		}
 	}
 
 	switch tree.kind {
 	case inlineElementKindRoot:
-		return c
+		if w.inlineHTML == nil {
+			w.inlineHTML = &htmlSanitizer{}
+			defer func() {
+				w.inlineHTML.close(w)
+				w.inlineHTML = nil
+			}()
+		}
+		children()
 	case inlineElementKindText:
-		return html.EscapeString(tree.s)
+		w.WriteString(html.EscapeString(tree.s))
 	case inlineElementKindBold:
-		return "<b>" + c + "</b>"
+		w.WriteString("<b>")
+		children()
+		w.WriteString("</b>")
+	case inlineElementKindItalic:
+		w.WriteString("<em>")
+		children()
+		w.WriteString("</em>")
+	case inlineElementKindStrikethrough:
+		w.WriteString("<del>")
+		children()
+		w.WriteString("</del>")
+	case inlineElementKindMark:
+		w.WriteString("<mark>")
+		children()
+		w.WriteString("</mark>")
 	case inlineElementKindCode:
-		return "<code>" + c + "</code>"
+		w.WriteString("<code>")
+		children()
+		w.WriteString("</code>")
+	case inlineElementKindFootnoteReference:
+		if tree.footnoteNumber == 0 {
+			w.WriteString(html.EscapeString("[^" + tree.footnoteLabel + "]"))
+			return
+		}
+		n := strconv.Itoa(tree.footnoteNumber)
+		w.WriteString("<sup class=\"footnote-ref\"><a href=\"#fn-" + n + "\" id=\"" + footnoteReferenceID(tree.footnoteNumber, tree.footnoteReferenceIndex) + "\">" + n + "</a></sup>")
+	case inlineElementKindRuby:
+		w.WriteString("<ruby>")
+		children()
+		w.WriteString("<rp>(</rp><rt>" + html.EscapeString(tree.rubyText) + "</rt><rp>)</rp></ruby>")
 	case inlineElementKindLink:
-		return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(tree.linkHref), c)
+		w.WriteString("<a href=\"" + html.EscapeString(tree.linkHref) + "\">")
+		children()
+		w.WriteString("</a>")
+	default:
+		panic("unknown inlineElementKind")
 	}
-
-	panic("unknown inlineElementKind")
 }
@@ -162,6 +162,71 @@ func TestBlockElementsToHTML(t *testing.T) {
 	})
 	test.AssertSame(t, got, expect)
 
+	expect = "<ol><li>str</li><li>str</li></ol><ol start=\"5\"><li>str</li></ol>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   1,
+		},
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   2,
+		},
+		{
+			kind: blockElementKindEmpty,
+		},
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   5,
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<ol><li>str</li><ul><li>str</li></ul><ol><li>str</li></ol><li>str</li></ol><ul><li>str</li></ul>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   1,
+		},
+		{
+			kind:      blockElementKindList,
+			children:  inline,
+			listLevel: 2,
+		},
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   2,
+			listOrdered: true,
+			listStart:   1,
+		},
+		{
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   2,
+		},
+		{
+			kind:      blockElementKindList,
+			children:  inline,
+			listLevel: 1,
+		},
+	})
+	test.AssertSame(t, got, expect)
+
 	expect = "<figure><img src=\"https://example.com/example.png\" alt=\"image\"><figcaption>image</figcaption></figure>"
 	got = blockElementsToHTML([]blockElement{
 		{
@@ -172,7 +237,7 @@ func TestBlockElementsToHTML(t *testing.T) {
 	})
 	test.AssertSame(t, got, expect)
 
-	expect = "<h1>str</h1><h2>str</h2><h3>str</h3>"
+	expect = "<h1>str</h1><h2>str</h2><h3>str</h3><h4>str</h4><h5>str</h5><h6>str</h6>"
 	got = blockElementsToHTML([]blockElement{
 		{
 			kind:     blockElementKindHeading1,
@@ -183,6 +248,15 @@ func TestBlockElementsToHTML(t *testing.T) {
 		}, {
 			kind:     blockElementKindHeading3,
 			children: inline,
+		}, {
+			kind:     blockElementKindHeading4,
+			children: inline,
+		}, {
+			kind:     blockElementKindHeading5,
+			children: inline,
+		}, {
+			kind:     blockElementKindHeading6,
+			children: inline,
 		},
 	})
 	test.AssertSame(t, got, expect)
@@ -204,12 +278,73 @@ func TestBlockElementsToHTML(t *testing.T) {
 	})
 	test.AssertSame(t, got, expect)
 
-	expect = "<details><summary>summary</summary>details</details>"
+	expect = "<pre><code class=\"language-go\"><span class=\"hl-keyword\">return</span> &lt;-ch</code></pre>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:     blockElementKindCodeBlock,
+			codeInfo: codeBlockInfo{language: "go"},
+			codeText: "return <-ch",
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<figure class=\"code-block\"><figcaption>main.go</figcaption><pre><code class=\"language-go\">" +
+		"<span class=\"line\"><span class=\"line-number\">1</span><span class=\"hl-comment\">/*</span></span>\n" +
+		"<span class=\"line line-highlighted\"><span class=\"line-number\">2</span><span class=\"hl-comment\">*/</span> x</span>" +
+		"</code></pre></figure>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind: blockElementKindCodeBlock,
+			codeInfo: codeBlockInfo{
+				language:        "go",
+				fileName:        "main.go",
+				highlightLines:  [][2]int{{2, 2}},
+				showLineNumbers: true,
+			},
+			codeText: "/*\n*/ x",
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<details><summary>summary</summary><p>str</p></details>"
 	got = blockElementsToHTML([]blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "summary",
-			detailsContentHTML: "details",
+			kind:           blockElementDetails,
+			detailsSummary: "summary",
+			blocks:         []blockElement{{kind: blockElementKindParagraph, children: inline}},
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<table><thead><tr><th>str</th><th style=\"text-align: center\">str</th></tr></thead><tbody><tr><td>str</td><td style=\"text-align: center\">str</td></tr></tbody></table>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:            blockElementKindTable,
+			tableHeader:     []inlineElement{inline, inline},
+			tableAlignments: []tableAlignment{tableAlignmentNone, tableAlignmentCenter},
+			tableRows: [][]inlineElement{
+				{inline, inline},
+			},
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<blockquote><p>str</p></blockquote>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:   blockElementKindBlockquote,
+			blocks: []blockElement{{kind: blockElementKindParagraph, children: inline}},
+		},
+	})
+	test.AssertSame(t, got, expect)
+
+	expect = "<aside class=\"callout callout-alert\"><p class=\"callout-title\">title</p><p>str</p></aside>"
+	got = blockElementsToHTML([]blockElement{
+		{
+			kind:         blockElementKindCallout,
+			calloutKind:  "alert",
+			calloutTitle: "title",
+			blocks:       []blockElement{{kind: blockElementKindParagraph, children: inline}},
 		},
 	})
 	test.AssertSame(t, got, expect)
@@ -315,4 +450,51 @@ func TestInlineElementTreeToHTML(t *testing.T) {
 		}),
 		"Hello, world!<b>Hello, world!</b><a href=\"https://example.com/example.html\"><b>Hello, world!</b></a>",
 	)
+
+	// 斜体、取り消し線、マーカー
+	test.AssertSame(
+		t,
+		inlineElementToHTML(inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind: inlineElementKindItalic,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "em"},
+					},
+				},
+				{
+					kind: inlineElementKindStrikethrough,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "del"},
+					},
+				},
+				{
+					kind: inlineElementKindMark,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "mark"},
+					},
+				},
+			},
+		}),
+		"<em>em</em><del>del</del><mark>mark</mark>",
+	)
+
+	// ルビ
+	test.AssertSame(
+		t,
+		inlineElementToHTML(inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind:     inlineElementKindRuby,
+					rubyText: "かんじ",
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "漢字"},
+					},
+				},
+			},
+		}),
+		"<ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby>",
+	)
 }
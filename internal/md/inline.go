@@ -2,120 +2,213 @@ package md
 
 import (
 	"strings"
+	"unicode"
 )
 
 // トークンに分割する
 func tokenize(str string) []token {
+	ret, _ := tokenizeWithPositions(str)
+	return ret
+}
+
+// トークンに分割し、各トークンが始まる位置 (str のルーン単位の添字) も返す
+func tokenizeWithPositions(str string) ([]token, []int) {
 	var ret []token
-	buf := ""
+	var positions []int
+	var buf strings.Builder
+	bufStart := 0
 
 	s := []rune(str)
 
-	for i := 0; i < len(s); i++ {
-		if i >= len(s) {
-			break
-		}
-
-		// capture ret, buf
-		flush := func() {
-			if len(buf) == 0 {
-				return
-			}
-			ret = append(ret, token{s: buf})
-			buf = ""
+	flush := func() {
+		if buf.Len() == 0 {
+			return
 		}
-		takeTwo := func() string {
-			if i >= len(s)-1 {
-				return string(s[i])
-			}
-			return string(s[i]) + string(s[i+1])
+		ret = append(ret, token{s: buf.String()})
+		positions = append(positions, bufStart)
+		buf.Reset()
+	}
+	// capture i
+	var i int
+	write := func(r rune) {
+		if buf.Len() == 0 {
+			bufStart = i
 		}
+		buf.WriteRune(r)
+	}
+	reserved := func(t string) {
+		flush()
+		ret = append(ret, token{r: true, s: t})
+		positions = append(positions, i)
+	}
 
-		c := string(s[i])
+	for i = 0; i < len(s); i++ {
+		c := s[i]
 
-		if c == "\\" {
-			if takeTwo() == "\\\\" {
-				buf += "\\"
-				i++
-				continue
-			}
-			if len(takeTwo()) == 2 {
-				buf += string([]rune(takeTwo())[1])
+		if c == '\\' {
+			// ASCII の文字とルビの記号のみエスケープできる。それ以外の文字の前の \ は取り除く
+			if i+1 < len(s) && (s[i+1] <= unicode.MaxASCII || s[i+1] == '｜' || s[i+1] == '《' || s[i+1] == '》') {
+				write(s[i+1])
 				i++
-				continue
 			}
 			continue
 		}
 
-		switch c {
-		case "<":
-			flush()
-			ret = append(ret, token{r: true, s: "<"})
-			continue
-		case ">":
-			flush()
-			ret = append(ret, token{r: true, s: ">"})
-			continue
-		case "[":
+		if e, end, ok := parseInlineExtension(s, i); ok {
 			flush()
-			ret = append(ret, token{r: true, s: "["})
+			// e のアドレスを直接取ると、拡張が一致しない文字でも e がヒープに確保される
+			p := new(inlineElement)
+			*p = e
+			ret = append(ret, token{s: string(s[i : end+1]), e: p})
+			positions = append(positions, i)
+			i = end
 			continue
-		case "]":
-			flush()
-			ret = append(ret, token{r: true, s: "]"})
+		}
+
+		// ** を * より先に検証する必要がある
+		if i+1 < len(s) && s[i+1] == c && (c == '*' || c == '~' || c == '=') {
+			reserved(string([]rune{c, c}))
+			i++
 			continue
-		case "(":
-			flush()
-			ret = append(ret, token{r: true, s: "("})
+		}
+
+		switch c {
+		case '_':
+			// snake_case のような単語中の _ と、__init__ のような連続した _ は強調として扱わない
+			if i > 0 && i < len(s)-1 && isASCIIAlphanumeric(s[i-1]) && isASCIIAlphanumeric(s[i+1]) ||
+				i > 0 && s[i-1] == '_' || i+1 < len(s) && s[i+1] == '_' {
+				write(c)
+				continue
+			}
+			reserved("_")
 			continue
-		case ")":
-			flush()
-			ret = append(ret, token{r: true, s: ")"})
+		case '*':
+			// 2 * 3 * 4 のような、前後に空白がある * は強調として扱わない
+			cannotOpen := i+1 < len(s) && unicode.IsSpace(s[i+1])
+			cannotClose := i > 0 && unicode.IsSpace(s[i-1])
+			if cannotOpen && cannotClose {
+				write(c)
+				continue
+			}
+			reserved("*")
+			ret[len(ret)-1].cannotOpen = cannotOpen
+			ret[len(ret)-1].cannotClose = cannotClose
 			continue
-		case "`":
-			flush()
-			ret = append(ret, token{r: true, s: "`"})
+		case '<', '>', '[', ']', '(', ')', '`', '｜', '《', '》', '{', '|', '}':
+			reserved(string(c))
 			continue
 		}
 
-		switch takeTwo() {
-		case "**":
-			flush()
-			ret = append(ret, token{r: true, s: "**"})
-			i++
+		write(c)
+	}
+
+	flush()
+
+	return ret, positions
+}
+
+// s[start] から始まるインライン要素の拡張を、登録順に試す
+func parseInlineExtension(s []rune, start int) (inlineElement, int, bool) {
+	for _, ext := range inlineExtensions {
+		if ext.trigger != s[start] {
 			continue
 		}
-
-		buf += c
+		if e, end, ok := ext.parse(s, start); ok {
+			return e, end, true
+		}
 	}
+	return inlineElement{}, 0, false
+}
 
-	if len(buf) != 0 {
-		ret = append(ret, token{s: buf})
+// s[start] の $ に対応する閉じの $ の位置を返す。見つからなければ -1 を返す。
+// $5 と $10 のような金額を数式として扱わないよう、$ の内側は空白以外で始まって終わり、閉じの $ の直後は数字でないものとする。
+func findInlineMathEnd(s []rune, start int) int {
+	if start+1 >= len(s) || unicode.IsSpace(s[start+1]) || s[start+1] == '$' {
+		return -1
+	}
+	for j := start + 1; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] != '$' {
+			continue
+		}
+		if unicode.IsSpace(s[j-1]) || (j+1 < len(s) && unicode.IsDigit(s[j+1])) {
+			return -1
+		}
+		return j
 	}
+	return -1
+}
 
-	return ret
+func isASCIIAlphanumeric(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
 }
 
-func findNextReservedToken(startIndex int, token string, tokens []token) int {
-	if startIndex+1 > len(tokens)-1 {
+// 対になる区切り文字で囲まれたインライン要素
+var inlineDelimiterKinds = map[string]inlineElementKind{
+	"**": inlineElementKindBold,
+	"*":  inlineElementKindItalic,
+	"_":  inlineElementKindItalic,
+	"~~": inlineElementKindStrikethrough,
+	"==": inlineElementKindMark,
+}
+
+// 予約トークンの種類ごとに、各位置から後ろで最初に現れる位置を求めておく。
+// 閉じられていない [ や < が 1 行に大量にあっても、閉じを探す時間が行の長さに対して線形になる
+type reservedTokenIndex struct {
+	tokens []token
+	next   map[string][]int
+}
+
+// tokens[startIndex+1:] で最初に現れる、閉じになれる予約トークン token の位置を返す。見つからなければ -1 を返す。
+func (x *reservedTokenIndex) find(startIndex int, token string) int {
+	if startIndex+1 >= len(x.tokens) {
 		return -1
 	}
-	for i := startIndex + 1; i < len(tokens); i++ {
-		if tokens[i].r && tokens[i].s == token {
-			return i
+	next, ok := x.next[token]
+	if !ok {
+		next = make([]int, len(x.tokens)+1)
+		next[len(x.tokens)] = -1
+		for i := len(x.tokens) - 1; i >= 0; i-- {
+			if x.tokens[i].r && x.tokens[i].s == token && !x.tokens[i].cannotClose {
+				next[i] = i
+			} else {
+				next[i] = next[i+1]
+			}
+		}
+		if x.next == nil {
+			x.next = make(map[string][]int)
 		}
+		x.next[token] = next
 	}
-	return -1
+	return next[startIndex+1]
+}
+
+// トークンの元の文字列をつなげる
+func concatTokens(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.s)
+	}
+	return b.String()
 }
 
 func parseTokens(tree inlineElement, tokens []token) inlineElement {
+	index := reservedTokenIndex{tokens: tokens}
 	for i := 0; i < len(tokens); i++ {
 		t := tokens[i]
 
-		if t.r && t.s == "**" {
-			c := findNextReservedToken(i, "**", tokens)
-			// 閉じタグが無ければ、通常の文字列として扱う
-			if c < 0 {
+		if t.e != nil {
+			tree.children = append(tree.children, *t.e)
+			continue
+		}
+
+		if k, ok := inlineDelimiterKinds[t.s]; t.r && ok {
+			c := index.find(i, t.s)
+			// 開きになれないか、閉じタグが無いか、中身が空なら、通常の文字列として扱う
+			if t.cannotOpen || c < 0 || c == i+1 {
 				tree.children = append(tree.children, inlineElement{
 					kind: inlineElementKindText,
 					s:    t.s,
@@ -124,14 +217,14 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 			}
 			tree.children = append(
 				tree.children,
-				parseTokens(inlineElement{kind: inlineElementKindBold}, tokens[i+1:c]),
+				parseTokens(inlineElement{kind: k}, tokens[i+1:c]),
 			)
 			i += c - i
 			continue
 		}
 
 		if t.r && t.s == "`" {
-			c := findNextReservedToken(i, "`", tokens)
+			c := index.find(i, "`")
 			// 閉じタグがなければ、通常の文字列として扱う
 			if c < 0 {
 				tree.children = append(tree.children, inlineElement{
@@ -140,16 +233,61 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 				})
 				continue
 			}
+			// インラインコードの中身は Markdown として解釈しない
+			code := concatTokens(tokens[i+1 : c])
 			tree.children = append(
 				tree.children,
-				parseTokens(inlineElement{kind: inlineElementKindCode}, tokens[i+1:c]),
+				inlineElement{kind: inlineElementKindCode, children: []inlineElement{
+					{kind: inlineElementKindText, s: code},
+				}},
 			)
 			i += c - i
 			continue
 		}
 
+		// ｜漢字《かんじ》 または {漢字|かんじ} のルビ
+		if t.r && (t.s == "｜" || t.s == "{") {
+			separator, end := "《", "》"
+			if t.s == "{" {
+				separator, end = "|", "}"
+			}
+
+			i1 := index.find(i, separator)
+			i2 := -1
+			if i1 > 0 {
+				i2 = index.find(i1, end)
+			}
+			// 親文字の途中に別のルビの記号があれば、{a} x {漢字|かんじ} の { のように対にならない
+			for _, other := range []string{"{", "}", "｜", "》"} {
+				if c := index.find(i, other); c > 0 && c < i1 {
+					i1, i2 = -1, -1
+				}
+			}
+			// 親文字とルビのどちらかが空なら、通常の文字列として扱う
+			if i1 < 0 || i2 < 0 || i1-i == 1 || i2-i1 == 1 {
+				tree.children = append(tree.children, inlineElement{
+					kind: inlineElementKindText,
+					s:    t.s,
+				})
+				continue
+			}
+
+			base := concatTokens(tokens[i+1 : i1])
+			ruby := concatTokens(tokens[i1+1 : i2])
+
+			tree.children = append(tree.children, inlineElement{
+				kind:     inlineElementKindRuby,
+				rubyText: ruby,
+				children: []inlineElement{
+					{kind: inlineElementKindText, s: base},
+				},
+			})
+			i += i2 - i
+			continue
+		}
+
 		if t.r && t.s == "<" {
-			cl := findNextReservedToken(i, ">", tokens)
+			cl := index.find(i, ">")
 			// 閉じタグがなければ、通常の文字列として扱う
 			if cl < 0 {
 				tree.children = append(tree.children, inlineElement{
@@ -160,10 +298,7 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 			}
 
 			// <...> の中身は URL の可能性があるので、普通の文字列として取得する
-			href := ""
-			for _, t := range tokens[i+1 : cl] {
-				href += t.s
-			}
+			href := concatTokens(tokens[i+1 : cl])
 
 			// <...> の中身が URL ではなかったら、リンクでは無かったとして扱う
 			if !(strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://")) {
@@ -185,8 +320,27 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 			continue
 		}
 
+		if t.r && t.s == "[" && i+1 < len(tokens) && !tokens[i+1].r && strings.HasPrefix(tokens[i+1].s, "^") {
+			c := index.find(i, "]")
+			label := ""
+			if c > 0 {
+				label = strings.TrimPrefix(concatTokens(tokens[i+1:c]), "^")
+			}
+
+			// [^label](...) はリンクなので、脚注としては扱わない
+			isLink := c > 0 && c+1 < len(tokens) && tokens[c+1].r && tokens[c+1].s == "("
+			if label != "" && !strings.ContainsAny(label, " \t") && !isLink {
+				tree.children = append(tree.children, inlineElement{
+					kind:          inlineElementKindFootnoteReference,
+					footnoteLabel: label,
+				})
+				i += c - i
+				continue
+			}
+		}
+
 		if t.r && t.s == "[" {
-			i1 := findNextReservedToken(i, "]", tokens)
+			i1 := index.find(i, "]")
 			// キーワードが順番に並んでいなければ、通常の文字列として扱う
 			if i1 < 0 || i1-i == 1 {
 				tree.children = append(tree.children, inlineElement{
@@ -195,7 +349,7 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 				})
 				continue
 			}
-			i2 := findNextReservedToken(i1, "(", tokens)
+			i2 := index.find(i1, "(")
 			if i2 < 0 || i2-i1 != 1 {
 				tree.children = append(tree.children, inlineElement{
 					kind: inlineElementKindText,
@@ -203,7 +357,7 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 				})
 				continue
 			}
-			i3 := findNextReservedToken(i2, ")", tokens)
+			i3 := index.find(i2, ")")
 			if i3 < 0 || i3-i2 == 1 {
 				tree.children = append(tree.children, inlineElement{
 					kind: inlineElementKindText,
@@ -213,10 +367,7 @@ func parseTokens(tree inlineElement, tokens []token) inlineElement {
 			}
 
 			// (...) の中身は URL の可能性があるので、普通の文字列として取得する
-			href := ""
-			for _, t := range tokens[i2+1 : i3] {
-				href += t.s
-			}
+			href := concatTokens(tokens[i2+1 : i3])
 
 			// (...) の中身が URL ではなかったら、リンクで無かったとして扱う
 			if !(strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://")) {
@@ -14,7 +14,9 @@ func TestTokenize(t *testing.T) {
 	expect = []token{
 		{s: "abc"},
 		{r: true, s: "**"},
-		{s: "def*gh"},
+		{s: "def"},
+		{r: true, s: "*"},
+		{s: "gh"},
 		{r: true, s: "<"},
 		{s: "fooo"},
 		{r: true, s: ">"},
@@ -25,7 +27,7 @@ func TestTokenize(t *testing.T) {
 	expect = []token{
 		{r: true, s: "**"},
 		{r: true, s: "**"},
-		{s: "*"},
+		{r: true, s: "*"},
 	}
 	test.AssertEquals(t, got, expect)
 
@@ -45,6 +47,51 @@ func TestTokenize(t *testing.T) {
 	expect = []token{{s: "*"}, {r: true, s: "**"}}
 	test.AssertEquals(t, got, expect)
 
+	got = tokenize("~~a~~==b==_c_")
+	expect = []token{
+		{r: true, s: "~~"},
+		{s: "a"},
+		{r: true, s: "~~"},
+		{r: true, s: "=="},
+		{s: "b"},
+		{r: true, s: "=="},
+		{r: true, s: "_"},
+		{s: "c"},
+		{r: true, s: "_"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// 単語中の _ は区切り文字ではない
+	got = tokenize("snake_case_name")
+	expect = []token{{s: "snake_case_name"}}
+	test.AssertEquals(t, got, expect)
+
+	// 連続した _ も区切り文字ではない
+	got = tokenize("__init__")
+	expect = []token{{s: "__init__"}}
+	test.AssertEquals(t, got, expect)
+
+	got = tokenize("｜漢字《かんじ》{a|b}\\{")
+	expect = []token{
+		{r: true, s: "｜"},
+		{s: "漢字"},
+		{r: true, s: "《"},
+		{s: "かんじ"},
+		{r: true, s: "》"},
+		{r: true, s: "{"},
+		{s: "a"},
+		{r: true, s: "|"},
+		{s: "b"},
+		{r: true, s: "}"},
+		{s: "{"},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// ルビの記号もエスケープできる
+	got = tokenize("\\｜漢字\\《かんじ\\》")
+	expect = []token{{s: "｜漢字《かんじ》"}}
+	test.AssertEquals(t, got, expect)
+
 	got = tokenize("日本語だよ😄")
 	expect = []token{{s: "日本語だよ😄"}}
 	test.AssertEquals(t, got, expect)
@@ -383,4 +430,142 @@ func TestParseTokens(t *testing.T) {
 			},
 		},
 	)
+
+	// 斜体、取り消し線、マーカー
+	test.AssertEquals(
+		t,
+		parseTokens(
+			inlineElement{kind: inlineElementKindRoot},
+			[]token{
+				{r: true, s: "*"},
+				{s: "em"},
+				{r: true, s: "*"},
+				{r: true, s: "~~"},
+				{s: "del"},
+				{r: true, s: "~~"},
+				{r: true, s: "=="},
+				{s: "mark"},
+				{r: true, s: "=="},
+				{r: true, s: "_"},
+				{s: "unclosed"},
+			},
+		),
+		inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind: inlineElementKindItalic,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "em"},
+					},
+				},
+				{
+					kind: inlineElementKindStrikethrough,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "del"},
+					},
+				},
+				{
+					kind: inlineElementKindMark,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "mark"},
+					},
+				},
+				{kind: inlineElementKindText, s: "_"},
+				{kind: inlineElementKindText, s: "unclosed"},
+			},
+		},
+	)
+
+	// インラインコードの中身は Markdown として解釈しない
+	test.AssertEquals(
+		t,
+		parseTokens(
+			inlineElement{kind: inlineElementKindRoot},
+			[]token{
+				{r: true, s: "`"},
+				{r: true, s: "*"},
+				{s: "a"},
+				{r: true, s: "*"},
+				{r: true, s: "`"},
+			},
+		),
+		inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind: inlineElementKindCode,
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "*a*"},
+					},
+				},
+			},
+		},
+	)
+
+	// ルビ
+	test.AssertEquals(
+		t,
+		parseTokens(
+			inlineElement{kind: inlineElementKindRoot},
+			[]token{
+				{r: true, s: "｜"},
+				{s: "漢字"},
+				{r: true, s: "《"},
+				{s: "かんじ"},
+				{r: true, s: "》"},
+				{r: true, s: "{"},
+				{s: "a"},
+				{r: true, s: "|"},
+				{r: true, s: "}"},
+			},
+		),
+		inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind:     inlineElementKindRuby,
+					rubyText: "かんじ",
+					children: []inlineElement{
+						{kind: inlineElementKindText, s: "漢字"},
+					},
+				},
+				{kind: inlineElementKindText, s: "{"},
+				{kind: inlineElementKindText, s: "a"},
+				{kind: inlineElementKindText, s: "|"},
+				{kind: inlineElementKindText, s: "}"},
+			},
+		},
+	)
+}
+
+func TestLoneAsterisk(t *testing.T) {
+	test.AssertEquals(t, ToHTML("2 * 3 * 4"), "<p>2 * 3 * 4</p>")
+	test.AssertEquals(t, ToHTML("a* b *c"), "<p>a* b *c</p>")
+	test.AssertEquals(t, ToHTML("*a *b* c*"), "<p><em>a *b</em> c*</p>")
+	test.AssertEquals(t, tokenize("a *b"), []token{{s: "a "}, {r: true, s: "*", cannotClose: true}, {s: "b"}})
+	test.AssertEquals(t, Lint("2 * 3 * 4"), []Diagnostic(nil))
+}
+
+func TestEmptyEmphasis(t *testing.T) {
+	// 強調にならない区切り文字は、取り除かずにそのまま出力する
+	test.AssertEquals(t, ToHTML("__init__"), "<p>__init__</p>")
+	test.AssertEquals(t, ToHTML("call __init__() and _a_"), "<p>call __init__() and <em>a</em></p>")
+	test.AssertEquals(t, ToHTML("a **** b ~~~~ c ===="), "<p>a **** b ~~~~ c ====</p>")
+}
+
+func TestRubyWithOtherDelimiters(t *testing.T) {
+	// 親文字の途中に別のルビの記号があれば、その開きの記号は文字列として扱う
+	test.AssertEquals(t, ToHTML("{a} x {漢字|かんじ}"), "<p>{a} x <ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby></p>")
+	test.AssertEquals(t, ToHTML("｜a b ｜漢字《かんじ》"), "<p>｜a b <ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby></p>")
+}
+
+func TestEscapeRuby(t *testing.T) {
+	test.AssertEquals(t, ToHTML("\\｜漢字《かんじ》"), "<p>｜漢字《かんじ》</p>")
+	test.AssertEquals(t, ToHTML("｜漢字\\《かんじ》"), "<p>｜漢字《かんじ》</p>")
+	test.AssertEquals(t, ToHTML("｜漢字《かんじ》"), "<p><ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby></p>")
+	// 整形しても、エスケープしたルビの記号は記法にならない
+	got, err := Format("\\｜漢字《かんじ》")
+	test.AssertEquals(t, err, nil)
+	test.AssertEquals(t, ToHTML(got), "<p>｜漢字《かんじ》</p>")
 }
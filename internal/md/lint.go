@@ -0,0 +1,300 @@
+package md
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type Severity int
+
+const (
+	// 出力はされるが、意図した通りではない可能性が高い
+	SeverityWarning Severity = iota
+	// 文書の残りの部分が意図せず隠れるなど、保存するべきではない
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Lint が見つけた問題
+type Diagnostic struct {
+	// 1 から始まる行番号と、行頭からの文字数 (1 から始まる)
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+var (
+	lintListMarkerPattern       = regexp.MustCompile(`^(?:  )*(?:- \[[ x]\] |- |\d{1,9}\. )`)
+	lintHeadingMarkerPattern    = regexp.MustCompile(`^#{1,6} +`)
+	lintFootnoteMarkerPattern   = regexp.MustCompile(`^\[\^[^\]\s]+\]: +`)
+	lintImageLikePattern        = regexp.MustCompile(`^!\[.*\]\(.*\)$`)
+	lintContainerStartPattern   = regexp.MustCompile(`^(?::::|<details>)`)
+	lintQuotePrefixPattern      = regexp.MustCompile(`^> ?`)
+	lintUnknownMathCommandError = "<merror>"
+)
+
+// パーサーが黙って通常の文字列として扱う記法の誤りを探す。
+// 結果は行番号と列の順に並ぶ。
+func Lint(md string) []Diagnostic {
+	lines := strings.Split(md, "\n")
+	return lint(lines, parseBlockLines(lines, 1))
+}
+
+// Lint と同じものを、パース済みの文書から求める
+func (d *Document) Lint() []Diagnostic {
+	return lint(d.lines, d.elements)
+}
+
+func lint(lines []string, elements []blockElement) []Diagnostic {
+	l := &linter{lines: lines}
+
+	l.footnoteDefinitions = make(map[string]int)
+	l.footnoteReferences = make(map[string]bool)
+	walkBlockElements(elements, func(e *blockElement) {
+		if e.kind != blockElementKindFootnoteDefinition {
+			return
+		}
+		if _, ok := l.footnoteDefinitions[e.footnoteLabel]; !ok {
+			l.footnoteDefinitions[e.footnoteLabel] = e.line
+		}
+	})
+
+	l.lintUncoveredLines(elements)
+	l.lintBlocks(elements, 0)
+
+	for label, line := range l.footnoteDefinitions {
+		if !l.footnoteReferences[label] {
+			l.report(line, 1, SeverityWarning, fmt.Sprintf("脚注 [^%s] は参照されていません", label))
+		}
+	}
+
+	slices.SortStableFunc(l.diagnostics, func(a, b Diagnostic) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return l.diagnostics
+}
+
+type linter struct {
+	lines       []string
+	diagnostics []Diagnostic
+	// 脚注の名前と、定義された行
+	footnoteDefinitions map[string]int
+	footnoteReferences  map[string]bool
+}
+
+func (l *linter) report(line, column int, severity Severity, message string) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Line: line, Column: column, Severity: severity, Message: message})
+}
+
+// 引用の中の要素について、行頭の > を取り除いた行と、取り除いた文字数を返す
+func (l *linter) source(line, quoteDepth int) (string, int) {
+	s := l.lines[line-1]
+	offset := 0
+	for range quoteDepth {
+		s = strings.TrimRightFunc(s, unicode.IsSpace)
+		m := lintQuotePrefixPattern.FindString(s)
+		s = s[len(m):]
+		offset += len([]rune(m))
+	}
+	return s, offset
+}
+
+// どの要素にも含まれない行は、閉じられていないコードブロックなどが末尾で捨てられたもの
+func (l *linter) lintUncoveredLines(elements []blockElement) {
+	covered := make([]bool, len(l.lines))
+	for _, e := range elements {
+		for i := e.line; i <= e.endLine; i++ {
+			covered[i-1] = true
+		}
+	}
+
+	for i, c := range covered {
+		if c {
+			continue
+		}
+		s := strings.TrimRightFunc(l.lines[i], unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(s, "```"):
+			l.report(i+1, 1, SeverityError, "コードブロックが閉じられていません")
+		case s == "$$":
+			l.report(i+1, 1, SeverityError, "数式ブロックが閉じられていません")
+		case lintContainerStartPattern.MatchString(s):
+			l.report(i+1, 1, SeverityError, "ブロックが閉じられていません")
+		default:
+			l.report(i+1, 1, SeverityWarning, "この行は出力されません")
+		}
+	}
+}
+
+func (l *linter) lintBlocks(elements []blockElement, quoteDepth int) {
+	for _, e := range elements {
+		switch e.kind {
+		case blockElementKindParagraph:
+			for line := e.line; line <= e.endLine; line++ {
+				s, offset := l.source(line, quoteDepth)
+				s = strings.TrimRightFunc(s, unicode.IsSpace)
+				if lintImageLikePattern.MatchString(s) {
+					if strings.Contains(s, "](http://") {
+						l.report(line, offset+1, SeverityWarning, "画像の URL は https:// で始まる必要があります")
+					} else {
+						l.report(line, offset+1, SeverityWarning, "画像として解釈できません。URL は https:// で始まり、英数字と / . - _ のみを含む必要があります")
+					}
+				}
+				l.lintInline(s, line, offset)
+			}
+		case blockElementKindList:
+			l.lintInlineAfterMarker(e.line, quoteDepth, lintListMarkerPattern)
+		case blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+			blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6:
+			l.lintInlineAfterMarker(e.line, quoteDepth, lintHeadingMarkerPattern)
+		case blockElementKindFootnoteDefinition:
+			l.lintInlineAfterMarker(e.line, quoteDepth, lintFootnoteMarkerPattern)
+		case blockElementKindCodeBlock:
+			// 閉じの ``` は、行末の空白を取り除かずに照合される
+			if s, _ := l.source(e.endLine, quoteDepth); e.endLine == e.line || s != "```" {
+				l.report(e.line, 1, SeverityError, "コードブロックが閉じられていません")
+			}
+			if render, ok := diagramRenderers[e.codeInfo.language]; ok {
+				if _, err := render(e.codeText); err != nil {
+					l.report(e.line, 1, SeverityWarning, "図として描画できないため、コードブロックとして出力します: "+err.Error())
+				}
+			}
+		case blockElementKindMath:
+			if s, _ := l.source(e.endLine, quoteDepth); e.endLine != e.line && strings.TrimSpace(s) != "$$" {
+				l.report(e.line, 1, SeverityError, "数式ブロックが閉じられていません")
+			}
+			if strings.Contains(latexToMathML(e.mathText, true), lintUnknownMathCommandError) {
+				l.report(e.line, 1, SeverityWarning, "対応していない LaTeX のコマンドがあります")
+			}
+		case blockElementDetails, blockElementKindCallout:
+			start, _ := l.source(e.line, quoteDepth)
+			end, _ := l.source(e.endLine, quoteDepth)
+			end = strings.TrimRightFunc(end, unicode.IsSpace)
+			closing := ":::"
+			if strings.HasPrefix(start, "<details>") {
+				closing = "</details>"
+			}
+			if e.endLine == e.line || end != closing {
+				l.report(e.line, 1, SeverityError, closing+" でブロックが閉じられていません")
+			}
+			l.lintBlocks(e.blocks, quoteDepth)
+		case blockElementKindBlockquote:
+			l.lintBlocks(e.blocks, quoteDepth+1)
+		}
+	}
+}
+
+// リストの - などを取り除いた、インライン要素の部分を検査する
+func (l *linter) lintInlineAfterMarker(line, quoteDepth int, marker *regexp.Regexp) {
+	s, offset := l.source(line, quoteDepth)
+	s = strings.TrimRightFunc(s, unicode.IsSpace)
+	m := marker.FindString(s)
+	l.lintInline(s[len(m):], line, offset+len([]rune(m)))
+}
+
+func (l *linter) lintInline(s string, line, offset int) {
+	tokens, positions := tokenizeWithPositions(s)
+	l.lintTokens(tokens, positions, line, offset)
+}
+
+// parseTokens と同じ順序で記法を解釈し、通常の文字列として扱われる記法を探す
+func (l *linter) lintTokens(tokens []token, positions []int, line, offset int) {
+	report := func(i int, severity Severity, message string) {
+		l.report(line, offset+positions[i]+1, severity, message)
+	}
+	concat := func(from, to int) string {
+		return concatTokens(tokens[from:to])
+	}
+	index := reservedTokenIndex{tokens: tokens}
+	isURL := func(s string) bool {
+		return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		if t.e != nil {
+			if t.e.kind == inlineElementKindMath && strings.Contains(latexToMathML(t.e.s, false), lintUnknownMathCommandError) {
+				report(i, SeverityWarning, "対応していない LaTeX のコマンドがあります")
+			}
+			continue
+		}
+		if !t.r {
+			continue
+		}
+
+		if _, ok := inlineDelimiterKinds[t.s]; ok || t.s == "`" {
+			if t.cannotOpen {
+				continue
+			}
+			c := index.find(i, t.s)
+			if c < 0 {
+				report(i, SeverityWarning, t.s+" が閉じられていません")
+				continue
+			}
+			if t.s != "`" {
+				l.lintTokens(tokens[i+1:c], positions[i+1:c], line, offset)
+			}
+			i = c
+			continue
+		}
+
+		if t.s == "[" && i+1 < len(tokens) && !tokens[i+1].r && strings.HasPrefix(tokens[i+1].s, "^") {
+			c := index.find(i, "]")
+			isLink := c > 0 && c+1 < len(tokens) && tokens[c+1].r && tokens[c+1].s == "("
+			if c > 0 && !isLink {
+				label := strings.TrimPrefix(concat(i+1, c), "^")
+				if label != "" && !strings.ContainsAny(label, " \t") {
+					l.footnoteReferences[label] = true
+					if _, ok := l.footnoteDefinitions[label]; !ok {
+						report(i, SeverityWarning, fmt.Sprintf("脚注 [^%s] が定義されていません", label))
+					}
+					i = c
+					continue
+				}
+			}
+		}
+
+		if t.s == "[" {
+			i1 := index.find(i, "]")
+			if i1 < 0 || i1+1 >= len(tokens) || !tokens[i1+1].r || tokens[i1+1].s != "(" {
+				continue
+			}
+			i3 := index.find(i1+1, ")")
+			if i3 < 0 {
+				continue
+			}
+			if !isURL(concat(i1+2, i3)) {
+				report(i, SeverityWarning, "リンクの URL は http:// または https:// で始まる必要があります")
+				continue
+			}
+			l.lintTokens(tokens[i+1:i1], positions[i+1:i1], line, offset)
+			i = i3
+			continue
+		}
+
+		// <https://...> の中身は URL なので検査しない
+		if t.s == "<" {
+			if c := index.find(i, ">"); c > 0 && isURL(concat(i+1, c)) {
+				i = c
+			}
+		}
+	}
+}
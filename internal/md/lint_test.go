@@ -0,0 +1,40 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		md     string
+		expect []Diagnostic
+	}{
+		{"# 見出し\n\n**強調** と [リンク](https://example.com)[^1]\n\n[^1]: 脚注", nil},
+		{"```go\nfunc main() {}", []Diagnostic{{1, 1, SeverityError, "コードブロックが閉じられていません"}}},
+		{"```", []Diagnostic{{1, 1, SeverityError, "コードブロックが閉じられていません"}}},
+		{"$$\nx", []Diagnostic{{1, 1, SeverityError, "数式ブロックが閉じられていません"}}},
+		{":::note\n本文", []Diagnostic{{1, 1, SeverityError, "::: でブロックが閉じられていません"}}},
+		{"> 引用\n> - a **b", []Diagnostic{{2, 7, SeverityWarning, "** が閉じられていません"}}},
+		{"## あ `code", []Diagnostic{{1, 6, SeverityWarning, "` が閉じられていません"}}},
+		{"[a](/relative)", []Diagnostic{{1, 1, SeverityWarning, "リンクの URL は http:// または https:// で始まる必要があります"}}},
+		{"a[^1]\n\n[^2]: b", []Diagnostic{
+			{1, 2, SeverityWarning, "脚注 [^1] が定義されていません"},
+			{3, 1, SeverityWarning, "脚注 [^2] は参照されていません"},
+		}},
+		{"![画像](http://example.com/a.png)", []Diagnostic{{1, 1, SeverityWarning, "画像の URL は https:// で始まる必要があります"}}},
+		{"$\\unknown$", []Diagnostic{{1, 1, SeverityWarning, "対応していない LaTeX のコマンドがあります"}}},
+	}
+
+	for _, c := range cases {
+		test.AssertEquals(t, Lint(c.md), c.expect)
+
+		// パース済みの文書からも同じ結果になる
+		d, err := Parse(c.md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEquals(t, d.Lint(), c.expect)
+	}
+}
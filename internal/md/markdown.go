@@ -1,45 +1,242 @@
 package md
 
 import (
+	"bufio"
+	"io"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
+// 行ごとに照合するパターン。行ごとにコンパイルしないよう、あらかじめコンパイルしておく
+var (
+	codeStartPattern          = regexp.MustCompile("^```(.*)$")
+	mathBlockPattern          = regexp.MustCompile(`^\$\$(.+)\$\$$`)
+	blockquotePattern         = regexp.MustCompile(`^> ?(.*)$`)
+	listPattern               = regexp.MustCompile(`^((?:  )*)- (.+)$`)
+	orderedListPattern        = regexp.MustCompile(`^((?:  )*)(\d{1,9})\. (.+)$`)
+	headPattern               = regexp.MustCompile(`^(#{1,6}) +(.+)$`)
+	footnoteDefinitionPattern = regexp.MustCompile(`^\[\^([^\]\s]+)\]: +(.+)$`)
+	tableDelimiterPattern     = regexp.MustCompile(`^(:?)-+(:?)$`)
+)
+
+// 出力の設定
+type Options struct {
+	// ブロック要素の開始タグに、元の文書での開始行を data-source-line 属性として出力する。
+	// エディタのプレビューで、入力欄とスクロール位置を合わせるために使う。
+	SourceLine bool
+	// CommonMark の仕様に従って解釈する。目次や脚注、数式などの独自の記法は使えない。
+	// 生の HTML は、通常のパーサーと同じく許可されたタグと属性だけを出力する。
+	CommonMark bool
+}
+
 func ToHTML(md string) string {
-	return blockElementsToHTML(parseBlock(md))
+	return ToHTMLWithOptions(md, Options{})
+}
+
+func ToHTMLWithOptions(md string, opts Options) string {
+	var b strings.Builder
+	// strings.Reader からの読み込みと strings.Builder への書き込みは失敗しない
+	RenderWithOptions(&b, strings.NewReader(md), opts)
+	return b.String()
+}
+
+// src の Markdown を HTML に変換して w に書き込む。
+// 目次や脚注、見出しの id のために src は最後まで読み込んでからパースする。
+// HTML は文字列として組み立てずに、w に直接書き込む。
+func Render(w io.Writer, src io.Reader) error {
+	return RenderWithOptions(w, src, Options{})
+}
+
+func RenderWithOptions(w io.Writer, src io.Reader, opts Options) error {
+	if opts.CommonMark {
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(w)
+		writeCommonMarkHTML(&htmlWriter{StringWriter: bw, options: opts}, parseCommonMark(string(b)), false)
+		return bw.Flush()
+	}
+
+	lines, err := readLines(src)
+	if err != nil {
+		return err
+	}
+
+	elements := parseBlockLines(lines, 1)
+	assignHeadingIDs(elements)
+
+	bw := bufio.NewWriter(w)
+	writeDocumentHTML(&htmlWriter{StringWriter: bw, options: opts}, elements)
+	return bw.Flush()
+}
+
+// 最後まで行ごとに読み込む。文書全体を 1 つの文字列として読み込んでから分割しないことで、文書の複製を減らす。
+// 結果は strings.Split(s, "\n") と同じ。
+func readLines(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(r)
+
+	var lines []string
+	for {
+		l, err := br.ReadString('\n')
+		if err == io.EOF {
+			return append(lines, l), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l[:len(l)-1])
+	}
 }
 
 func parseBlock(s string) []blockElement {
+	return parseBlockLines(strings.Split(s, "\n"), 1)
+}
+
+// firstLine は lines[0] の元の文書での行番号
+func parseBlockLines(lines []string, firstLine int) []blockElement {
+	p := &blockParser{lines: lines, firstLine: firstLine}
+	return p.parse(lines, firstLine)
+}
+
+// 引用の中身や、Format が確かめる 1 つの要素のような、文書の一部をパースする。
+// 入れ子の引用ごとに行数分の要素を確保しないよう、parseBlockLines と違って要素の領域を先に確保しない
+func parseBlockFragment(lines []string, firstLine int) []blockElement {
+	p := &blockParser{lines: lines, firstLine: firstLine, fragment: true}
+	return p.parse(lines, firstLine)
+}
+
+// 1 つの文書のパース。:::details などの中身は、同じ blockParser で再帰的にパースする
+type blockParser struct {
+	// 文書全体の行と、lines[0] の元の文書での行番号
+	lines     []string
+	firstLine int
+	// コンテナの拡張ごとの、開始行の添字から対応する終了行の添字への対応。閉じられていなければ -1。
+	// 入れ子の深さごとに中身から終了行を探し直すと、深さに対して 2 乗の時間がかかるので、文書全体で 1 度だけ求める
+	containerEnds map[*blockExtension][]int
+
+	// <summary> の行の添字。summaryNext[k] は、summaryLines[k:] のうち <details> の要約として使われていない最初のもの
+	summaryLines []int
+	summaryNext  []int
+	// 要約として使われた行は、空行として扱う
+	summaryUsed []bool
+
+	// 文書の一部のパース。parse で要素の領域を先に確保しない
+	fragment bool
+}
+
+// 行番号 line から始まるコンテナ ext の、終了行の行番号を返す。閉じられていなければ -1 を返す
+func (p *blockParser) containerEnd(ext *blockExtension, line int) int {
+	ends, ok := p.containerEnds[ext]
+	if !ok {
+		ends = make([]int, len(p.lines))
+		// 開いているコンテナの開始行の添字
+		var open []int
+		for i, l := range p.lines {
+			ends[i] = -1
+			t := strings.TrimRightFunc(l, unicode.IsSpace)
+			if ext.start.MatchString(t) {
+				open = append(open, i)
+			} else if ext.end.MatchString(t) && len(open) > 0 {
+				ends[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		}
+		if p.containerEnds == nil {
+			p.containerEnds = make(map[*blockExtension][]int)
+		}
+		p.containerEnds[ext] = ends
+	}
+
+	end := ends[line-p.firstLine]
+	if end < 0 {
+		return -1
+	}
+	return p.firstLine + end
+}
+
+// 行番号 from から to までで、まだ <details> の要約として使われていない最初の <summary> の行を、使われたことにして返す。
+// 見つからなければ -1 を返す
+func (p *blockParser) takeSummaryLine(from, to int) int {
+	if p.summaryNext == nil {
+		for i, l := range p.lines {
+			if detailsSummaryPattern.MatchString(l) {
+				p.summaryLines = append(p.summaryLines, i)
+			}
+		}
+		p.summaryNext = make([]int, len(p.summaryLines)+1)
+		for k := range p.summaryNext {
+			p.summaryNext[k] = k
+		}
+		p.summaryUsed = make([]bool, len(p.lines))
+	}
+
+	k := sort.SearchInts(p.summaryLines, from-p.firstLine)
+	next := k
+	for p.summaryNext[next] != next {
+		next = p.summaryNext[next]
+	}
+	// 入れ子の <details> が使われた行を何度も読み飛ばさないよう、たどった先を覚えておく
+	for k != next {
+		p.summaryNext[k], k = next, p.summaryNext[k]
+	}
+	if k == len(p.summaryLines) || p.summaryLines[k] > to-p.firstLine {
+		return -1
+	}
+	p.summaryNext[k] = k + 1
+	p.summaryUsed[p.summaryLines[k]] = true
+	return p.firstLine + p.summaryLines[k]
+}
+
+// lines は p.lines の一部で、firstLine は lines[0] の元の文書での行番号
+func (p *blockParser) parse(lines []string, firstLine int) []blockElement {
 	var ret []blockElement
+	// blockElement は大きいので、append で伸ばしながら複製すると、確保する量が要素の数倍になる。
+	// 要素はそれぞれ 1 行以上を占めるので、文書全体のときは行数分を先に確保しておく。コンテナの中身では確保しない
+	if !p.fragment && len(lines) == len(p.lines) {
+		ret = make([]blockElement, 0, len(lines))
+	}
 
 	curr := inlineElement{
 		kind: inlineElementKindRoot,
 	}
+	var currLine int
 
 	var isCodeBlock bool
-	var codeBlockName string
+	var codeBlockInfo codeBlockInfo
 	var codeBlockLines []string
+	var codeBlockLine int
 
-	var isDetails bool
-	var isCustomDetails bool
-	var isDetailsSummaryParsed bool
-	var detailsSummary string
-	var detailsContentLines []string
+	var isMath bool
+	var mathLines []string
+	var mathLine int
 
-	for _, l := range strings.Split(s, "\n") {
-		// capture curr, ret
-		flush := func() {
-			if len(curr.children) > 0 {
-				ret = append(ret, blockElement{
-					kind:     blockElementKindParagraph,
-					children: curr,
-				})
-				curr = inlineElement{
-					kind: inlineElementKindRoot,
-				}
+	var lineNo int
+
+	// capture curr, ret, lineNo
+	flush := func() {
+		if len(curr.children) > 0 {
+			ret = append(ret, blockElement{
+				kind:     blockElementKindParagraph,
+				children: curr,
+				line:     currLine,
+				endLine:  lineNo - 1,
+			})
+			curr = inlineElement{
+				kind: inlineElementKindRoot,
 			}
 		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		lineNo = firstLine + i
+		if p.summaryUsed != nil && p.summaryUsed[lineNo-p.firstLine] {
+			l = ""
+		}
 
 		if isCodeBlock {
 			if l == "```" {
@@ -48,7 +245,9 @@ func parseBlock(s string) []blockElement {
 				ret = append(ret, blockElement{
 					kind:     blockElementKindCodeBlock,
 					codeText: strings.Join(codeBlockLines, "\n"),
-					codeName: codeBlockName,
+					codeInfo: codeBlockInfo,
+					line:     codeBlockLine,
+					endLine:  lineNo,
 				})
 
 				codeBlockLines = nil
@@ -59,112 +258,126 @@ func parseBlock(s string) []blockElement {
 			continue
 		}
 
-		if isDetails && isCustomDetails {
-			if l == ":::" {
-				ret = append(ret, blockElement{
-					kind:               blockElementDetails,
-					detailsSummary:     detailsSummary,
-					detailsContentHTML: ToHTML(strings.Join(detailsContentLines, "\n")),
-				})
+		if isMath {
+			if strings.TrimSpace(l) == "$$" {
+				isMath = false
 
-				isDetails = false
-				isCustomDetails = false
-				isDetailsSummaryParsed = false
-				detailsSummary = ""
-				detailsContentLines = nil
-				continue
-			}
-
-			detailsContentLines = append(detailsContentLines, l)
-			continue
-		}
-
-		if isDetails {
-			summaryPattern := regexp.MustCompile(`^<summary>(.+)<\/summary>$`)
-			if !isDetailsSummaryParsed {
-				if m := summaryPattern.FindStringSubmatch(l); len(m) > 0 {
-					detailsSummary = m[1]
-					isDetailsSummaryParsed = true
-					continue
-				}
-			}
-			if l == "</details>" {
 				ret = append(ret, blockElement{
-					kind:               blockElementDetails,
-					detailsSummary:     detailsSummary,
-					detailsContentHTML: ToHTML(strings.Join(detailsContentLines, "\n")),
+					kind:     blockElementKindMath,
+					mathText: strings.Join(mathLines, "\n"),
+					line:     mathLine,
+					endLine:  lineNo,
 				})
 
-				isDetails = false
-				isDetailsSummaryParsed = false
-				detailsSummary = ""
-				detailsContentLines = nil
+				mathLines = nil
 				continue
 			}
 
-			detailsContentLines = append(detailsContentLines, l)
+			mathLines = append(mathLines, l)
 			continue
 		}
 
 		// コードブロック中は Markdown として解釈してはならないので、ここより上で処理する必要がある
 		l = strings.TrimRightFunc(l, unicode.IsSpace)
 
-		codeStartPattern := regexp.MustCompile("^```(.*)$")
 		if m := codeStartPattern.FindStringSubmatch(l); len(m) > 0 {
 			flush()
 
-			codeBlockName = m[1]
+			codeBlockInfo = parseCodeBlockInfo(m[1])
 
 			isCodeBlock = true
 			codeBlockLines = nil
+			codeBlockLine = lineNo
 			continue
 		}
 
-		if l == "<details>" {
+		if l == "$$" {
 			flush()
 
-			isDetails = true
+			isMath = true
+			mathLines = nil
+			mathLine = lineNo
 			continue
 		}
 
-		customDetailsPattern := regexp.MustCompile("^:::details (.+)$")
-		if m := customDetailsPattern.FindStringSubmatch(l); len(m) > 0 {
+		if m := mathBlockPattern.FindStringSubmatch(l); len(m) > 0 {
 			flush()
 
-			detailsSummary = m[1]
+			ret = append(ret, blockElement{
+				kind:     blockElementKindMath,
+				mathText: strings.TrimSpace(m[1]),
+				line:     lineNo,
+				endLine:  lineNo,
+			})
+			continue
+		}
 
-			isDetails = true
-			isCustomDetails = true
+		if l == "[[toc]]" {
+			flush()
+			ret = append(ret, blockElement{
+				kind:    blockElementKindTOC,
+				line:    lineNo,
+				endLine: lineNo,
+			})
 			continue
 		}
 
-		// 簡単のため、リストのインデントは常にスペース2つとする
-		// checkboxList は有効な list なので、list より前に検証する必要がある
-		checkboxListPattern := regexp.MustCompile(`^((?:  )*)- \[([ x])\] (.+)$`)
-		if m := checkboxListPattern.FindStringSubmatch(l); len(m) > 0 {
+		if ext, m := matchBlockExtension(l); ext != nil {
 			flush()
 
-			d := m[1]
-			ch := m[2]
-			c := m[3]
+			if ext.end != nil {
+				// 閉じられていなければ、最後の行までを中身とする。中身が無ければ何も出力しない
+				end := p.containerEnd(ext, lineNo)
+				if end < 0 || end >= firstLine+len(lines) {
+					if i+1 < len(lines) {
+						e := ext.parse(p, m, lines[i+1:], lineNo+1)
+						e.line = lineNo
+						e.endLine = firstLine + len(lines) - 1
+						ret = append(ret, e)
+					}
+					i = len(lines)
+					continue
+				}
 
-			checked := false
-			if ch == "x" {
-				checked = true
+				e := ext.parse(p, m, lines[i+1:end-firstLine], lineNo+1)
+				e.line = lineNo
+				e.endLine = end
+				ret = append(ret, e)
+				i = end - firstLine
+				continue
+			}
+
+			e := ext.parse(p, m, nil, lineNo)
+			e.line = lineNo
+			e.endLine = lineNo
+			ret = append(ret, e)
+			continue
+		}
+
+		// 引用の中身は再帰的に Markdown として解釈する
+		if m := blockquotePattern.FindStringSubmatch(l); len(m) > 0 {
+			flush()
+
+			quoteLines := []string{m[1]}
+			for i+1 < len(lines) {
+				m := blockquotePattern.FindStringSubmatch(strings.TrimRightFunc(lines[i+1], unicode.IsSpace))
+				if len(m) == 0 {
+					break
+				}
+				quoteLines = append(quoteLines, m[1])
+				i++
 			}
 
 			ret = append(ret, blockElement{
-				kind:              blockElementKindList,
-				children:          parseInlineTree(c),
-				listLevel:         len(d)/2 + 1,
-				checkboxList:      true,
-				checkboxIsChecked: checked,
+				kind:    blockElementKindBlockquote,
+				blocks:  parseBlockFragment(quoteLines, lineNo),
+				line:    lineNo,
+				endLine: firstLine + i,
 			})
 			continue
 		}
 
 		// 簡単のため、リストのインデントは常にスペース2つとする
-		listPattern := regexp.MustCompile((`^((?:  )*)- (.+)$`))
 		if m := listPattern.FindStringSubmatch(l); len(m) > 0 {
 			flush()
 
@@ -175,11 +388,32 @@ func parseBlock(s string) []blockElement {
 				kind:      blockElementKindList,
 				children:  parseInlineTree(c),
 				listLevel: len(d)/2 + 1,
+				line:      lineNo,
+				endLine:   lineNo,
+			})
+			continue
+		}
+
+		// 簡単のため、リストのインデントは常にスペース2つとする
+		if m := orderedListPattern.FindStringSubmatch(l); len(m) > 0 {
+			flush()
+
+			d := m[1]
+			n, _ := strconv.Atoi(m[2])
+			c := m[3]
+
+			ret = append(ret, blockElement{
+				kind:        blockElementKindList,
+				children:    parseInlineTree(c),
+				listLevel:   len(d)/2 + 1,
+				listOrdered: true,
+				listStart:   n,
+				line:        lineNo,
+				endLine:     lineNo,
 			})
 			continue
 		}
 
-		headPattern := regexp.MustCompile(`^(##?#?) +(.+)$`)
 		if m := headPattern.FindStringSubmatch(l); len(m) > 0 {
 			flush()
 
@@ -192,48 +426,101 @@ func parseBlock(s string) []blockElement {
 				k = blockElementKindHeading2
 			case "###":
 				k = blockElementKindHeading3
+			case "####":
+				k = blockElementKindHeading4
+			case "#####":
+				k = blockElementKindHeading5
+			case "######":
+				k = blockElementKindHeading6
 			}
 
 			ret = append(ret, blockElement{
-				kind: k,
-				children: inlineElement{
-					kind: inlineElementKindText,
-					s:    title,
-				},
+				kind:     k,
+				children: parseInlineTree(title),
+				line:     lineNo,
+				endLine:  lineNo,
 			})
 			continue
 		}
 
-		imagePattern := regexp.MustCompile(`^!\[(.+)\]\((https:\/\/[\w/.\-_]+)\)$`)
-		if m := imagePattern.FindStringSubmatch(l); len(m) > 0 {
+		if m := footnoteDefinitionPattern.FindStringSubmatch(l); len(m) > 0 {
 			flush()
 
-			caption := m[1]
-			src := m[2]
-
 			ret = append(ret, blockElement{
-				kind:         blockElementKindImage,
-				imageSrc:     src,
-				imageCaption: caption,
+				kind:          blockElementKindFootnoteDefinition,
+				footnoteLabel: m[1],
+				children:      parseInlineTree(m[2]),
+				line:          lineNo,
+				endLine:       lineNo,
 			})
 			continue
 		}
 
+		// テーブルはヘッダ行と区切り行の 2 行が揃ったときのみ開始する
+		if i+1 < len(lines) {
+			header := splitTableRow(l)
+			alignments, ok := parseTableDelimiterRow(strings.TrimRightFunc(lines[i+1], unicode.IsSpace))
+			if header != nil && ok && len(header) == len(alignments) {
+				flush()
+
+				e := blockElement{
+					kind:            blockElementKindTable,
+					tableAlignments: alignments,
+					line:            lineNo,
+				}
+				for _, c := range header {
+					e.tableHeader = append(e.tableHeader, parseInlineTree(c))
+				}
+
+				i++
+				for i+1 < len(lines) {
+					cells := splitTableRow(strings.TrimRightFunc(lines[i+1], unicode.IsSpace))
+					if cells == nil {
+						break
+					}
+					i++
+
+					// 列数はヘッダに合わせ、足りなければ空のセルで埋め、多ければ捨てる
+					row := make([]inlineElement, len(header))
+					for j := range row {
+						row[j] = inlineElement{kind: inlineElementKindRoot}
+						if j < len(cells) {
+							row[j] = parseInlineTree(cells[j])
+						}
+					}
+					e.tableRows = append(e.tableRows, row)
+				}
+
+				e.endLine = firstLine + i
+				ret = append(ret, e)
+				continue
+			}
+		}
+
 		if l == "" {
 			flush()
 			ret = append(ret, blockElement{
-				kind: blockElementKindEmpty,
+				kind:    blockElementKindEmpty,
+				line:    lineNo,
+				endLine: lineNo,
 			})
 			continue
 		}
 
+		if len(curr.children) == 0 {
+			currLine = lineNo
+		}
 		curr.children = append(curr.children, parseInlineTree(l))
 	}
 
+	lastLine := firstLine + len(lines) - 1
+
 	if len(curr.children) > 0 {
 		ret = append(ret, blockElement{
 			kind:     blockElementKindParagraph,
 			children: curr,
+			line:     currLine,
+			endLine:  lastLine,
 		})
 		curr = inlineElement{
 			kind: inlineElementKindRoot,
@@ -243,23 +530,165 @@ func parseBlock(s string) []blockElement {
 	if isCodeBlock && len(codeBlockLines) > 0 {
 		ret = append(ret, blockElement{
 			kind:     blockElementKindCodeBlock,
-			codeName: codeBlockName,
+			codeInfo: codeBlockInfo,
 			codeText: strings.Join(codeBlockLines, "\n"),
+			line:     codeBlockLine,
+			endLine:  lastLine,
 		})
 	}
 
-	if isDetails && len(detailsContentLines) > 0 {
+	if isMath && len(mathLines) > 0 {
 		ret = append(ret, blockElement{
-			kind:               blockElementDetails,
-			detailsSummary:     detailsSummary,
-			detailsContentHTML: ToHTML(strings.Join(detailsContentLines, "\n")),
+			kind:     blockElementKindMath,
+			mathText: strings.Join(mathLines, "\n"),
+			line:     mathLine,
+			endLine:  lastLine,
 		})
 	}
 
 	return ret
 }
 
+// 行頭の構文が一致する拡張を、登録順に探す
+func matchBlockExtension(l string) (*blockExtension, []string) {
+	for i := range blockExtensions {
+		if m := blockExtensions[i].start.FindStringSubmatch(l); len(m) > 0 {
+			return &blockExtensions[i], m
+		}
+	}
+	return nil, nil
+}
+
+// ::: で囲まれたコンテナの中身を再帰的に Markdown として解釈する
+func containerBlockElement(p *blockParser, kind, title string, lines []string, firstLine int) blockElement {
+	if kind == "details" {
+		return blockElement{
+			kind:           blockElementDetails,
+			detailsSummary: title,
+			blocks:         p.parse(lines, firstLine),
+		}
+	}
+
+	return blockElement{
+		kind:         blockElementKindCallout,
+		calloutKind:  kind,
+		calloutTitle: title,
+		blocks:       p.parse(lines, firstLine),
+	}
+}
+
 func parseInlineTree(s string) inlineElement {
 	tokens := tokenize(s)
 	return parseTokens(inlineElement{kind: inlineElementKindRoot}, tokens)
 }
+
+// テーブルの行をセルに分割する。| を含まない行はテーブルの行ではないので nil を返す。
+// \| はセルの区切りとして扱わず、エスケープは parseInlineTree に任せる。
+func splitTableRow(l string) []string {
+	l = strings.TrimSpace(l)
+	if l == "" {
+		return nil
+	}
+
+	var cells []string
+	start := 0
+	for i := 0; i < len(l); i++ {
+		// | と \ は ASCII なので、バイト単位で走査してよい
+		if l[i] == '\\' && i+1 < len(l) {
+			i++
+			continue
+		}
+		if l[i] == '|' {
+			cells = append(cells, l[start:i])
+			start = i + 1
+		}
+	}
+	cells = append(cells, l[start:])
+
+	if len(cells) == 1 {
+		return nil
+	}
+
+	// 先頭と末尾の | は区切りではなく、行の囲みとして扱う
+	if strings.HasPrefix(l, "|") {
+		cells = cells[1:]
+	}
+	if strings.HasSuffix(l, "|") && !strings.HasSuffix(l, "\\|") {
+		cells = cells[:len(cells)-1]
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// テーブルの区切り行 (|---|:---:|---:|) をパースして、各列の配置を返す
+func parseTableDelimiterRow(l string) ([]tableAlignment, bool) {
+	cells := splitTableRow(l)
+	if cells == nil {
+		return nil, false
+	}
+
+	var ret []tableAlignment
+	for _, c := range cells {
+		m := tableDelimiterPattern.FindStringSubmatch(c)
+		if len(m) == 0 {
+			return nil, false
+		}
+
+		switch {
+		case m[1] == ":" && m[2] == ":":
+			ret = append(ret, tableAlignmentCenter)
+		case m[1] == ":":
+			ret = append(ret, tableAlignmentLeft)
+		case m[2] == ":":
+			ret = append(ret, tableAlignmentRight)
+		default:
+			ret = append(ret, tableAlignmentNone)
+		}
+	}
+
+	return ret, true
+}
+
+// コードブロックの開始行の ``` 以降をパースする。
+// 最初の語は言語名とファイル名を : で区切ったもので、{1,3-5} は強調する行、showLineNumbers は行番号の表示を表す。
+func parseCodeBlockInfo(s string) codeBlockInfo {
+	var ret codeBlockInfo
+
+	fields := strings.Fields(s)
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "{") && fields[0] != "showLineNumbers" {
+		lang, fileName, _ := strings.Cut(fields[0], ":")
+		ret.language = lang
+		ret.fileName = fileName
+		fields = fields[1:]
+	}
+
+	for _, f := range fields {
+		if f == "showLineNumbers" {
+			ret.showLineNumbers = true
+			continue
+		}
+
+		if strings.HasPrefix(f, "{") && strings.HasSuffix(f, "}") {
+			for _, r := range strings.Split(f[1:len(f)-1], ",") {
+				a, b, isRange := strings.Cut(r, "-")
+				if !isRange {
+					b = a
+				}
+				start, err1 := strconv.Atoi(strings.TrimSpace(a))
+				end, err2 := strconv.Atoi(strings.TrimSpace(b))
+				if err1 != nil || err2 != nil || start < 1 || end < start {
+					continue
+				}
+				ret.highlightLines = append(ret.highlightLines, [2]int{start, end})
+			}
+		}
+	}
+
+	return ret
+}
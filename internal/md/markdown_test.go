@@ -1,7 +1,11 @@
 package md
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/comame/note.comame.xyz/internal/test"
 )
@@ -41,13 +45,19 @@ func TestParseBlock(t *testing.T) {
 inline`)
 	expect = []blockElement{
 		{
+			line:     1,
+			endLine:  1,
 			kind:     blockElementKindParagraph,
 			children: doubleRootInline,
 		},
 		{
-			kind: blockElementKindEmpty,
+			line:    2,
+			endLine: 2,
+			kind:    blockElementKindEmpty,
 		},
 		{
+			line:     3,
+			endLine:  3,
 			kind:     blockElementKindParagraph,
 			children: doubleRootInline,
 		},
@@ -63,29 +73,41 @@ inline`)
 - inline`)
 	expect = []blockElement{
 		{
+			line:      1,
+			endLine:   1,
 			kind:      blockElementKindList,
 			children:  inline,
 			listLevel: 1,
 		},
 		{
+			line:      2,
+			endLine:   2,
 			kind:      blockElementKindList,
 			children:  inline,
 			listLevel: 2,
 		},
 		{
+			line:      3,
+			endLine:   3,
 			kind:      blockElementKindList,
 			children:  inline,
 			listLevel: 3,
 		},
 		{
+			line:      4,
+			endLine:   4,
 			kind:      blockElementKindList,
 			children:  inline,
 			listLevel: 1,
 		},
 		{
-			kind: blockElementKindEmpty,
+			line:    5,
+			endLine: 5,
+			kind:    blockElementKindEmpty,
 		},
 		{
+			line:      6,
+			endLine:   6,
 			kind:      blockElementKindList,
 			children:  inline,
 			listLevel: 1,
@@ -98,6 +120,8 @@ inline`)
 - [x] inline`)
 	expect = []blockElement{
 		{
+			line:              1,
+			endLine:           1,
 			kind:              blockElementKindList,
 			checkboxList:      true,
 			checkboxIsChecked: false,
@@ -105,6 +129,8 @@ inline`)
 			children:          inline,
 		},
 		{
+			line:              2,
+			endLine:           2,
 			kind:              blockElementKindList,
 			checkboxList:      true,
 			checkboxIsChecked: true,
@@ -114,30 +140,141 @@ inline`)
 	}
 	test.AssertEquals(t, got, expect)
 
+	// 番号付きリスト
+	got = parseBlock(`3. inline
+  - inline
+  1. inline
+4. inline`)
+	expect = []blockElement{
+		{
+			line:        1,
+			endLine:     1,
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   3,
+		},
+		{
+			line:      2,
+			endLine:   2,
+			kind:      blockElementKindList,
+			children:  inline,
+			listLevel: 2,
+		},
+		{
+			line:        3,
+			endLine:     3,
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   2,
+			listOrdered: true,
+			listStart:   1,
+		},
+		{
+			line:        4,
+			endLine:     4,
+			kind:        blockElementKindList,
+			children:    inline,
+			listLevel:   1,
+			listOrdered: true,
+			listStart:   4,
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
 	// タイトル
+	heading := func(s string) inlineElement {
+		return inlineElement{
+			kind: inlineElementKindRoot,
+			children: []inlineElement{
+				{
+					kind: inlineElementKindText,
+					s:    s,
+				},
+			},
+		}
+	}
 	got = parseBlock(`# heading 1
 ## heading 2
-### heading 3`)
+### heading 3
+#### heading 4
+##### heading 5
+###### heading 6
+####### heading 7`)
 	expect = []blockElement{
 		{
-			kind: blockElementKindHeading1,
-			children: inlineElement{
-				kind: inlineElementKindText,
-				s:    "heading 1",
-			},
+			line:     1,
+			endLine:  1,
+			kind:     blockElementKindHeading1,
+			children: heading("heading 1"),
+		},
+		{
+			line:     2,
+			endLine:  2,
+			kind:     blockElementKindHeading2,
+			children: heading("heading 2"),
+		},
+		{
+			line:     3,
+			endLine:  3,
+			kind:     blockElementKindHeading3,
+			children: heading("heading 3"),
+		},
+		{
+			line:     4,
+			endLine:  4,
+			kind:     blockElementKindHeading4,
+			children: heading("heading 4"),
+		},
+		{
+			line:     5,
+			endLine:  5,
+			kind:     blockElementKindHeading5,
+			children: heading("heading 5"),
+		},
+		{
+			line:     6,
+			endLine:  6,
+			kind:     blockElementKindHeading6,
+			children: heading("heading 6"),
 		},
 		{
-			kind: blockElementKindHeading2,
+			line:    7,
+			endLine: 7,
+			kind:    blockElementKindParagraph,
 			children: inlineElement{
-				kind: inlineElementKindText,
-				s:    "heading 2",
+				kind:     inlineElementKindRoot,
+				children: []inlineElement{heading("####### heading 7")},
 			},
 		},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// タイトル中のインライン要素
+	got = parseBlock("## **bold** and `code`")
+	expect = []blockElement{
 		{
-			kind: blockElementKindHeading3,
+			line:    1,
+			endLine: 1,
+			kind:    blockElementKindHeading2,
 			children: inlineElement{
-				kind: inlineElementKindText,
-				s:    "heading 3",
+				kind: inlineElementKindRoot,
+				children: []inlineElement{
+					{
+						kind: inlineElementKindBold,
+						children: []inlineElement{
+							{kind: inlineElementKindText, s: "bold"},
+						},
+					},
+					{kind: inlineElementKindText, s: " and "},
+					{
+						kind: inlineElementKindCode,
+						children: []inlineElement{
+							{kind: inlineElementKindText, s: "code"},
+						},
+					},
+				},
 			},
 		},
 	}
@@ -147,6 +284,8 @@ inline`)
 	got = parseBlock(`![caption](https://example.com)`)
 	expect = []blockElement{
 		{
+			line:         1,
+			endLine:      1,
 			kind:         blockElementKindImage,
 			imageSrc:     "https://example.com",
 			imageCaption: "caption",
@@ -158,8 +297,10 @@ inline`)
 	got = parseBlock("```file\nsource code\n```")
 	expect = []blockElement{
 		{
+			line:     1,
+			endLine:  3,
 			kind:     blockElementKindCodeBlock,
-			codeName: "file",
+			codeInfo: codeBlockInfo{language: "file"},
 			codeText: "source code",
 		},
 	}
@@ -167,13 +308,32 @@ inline`)
 	got = parseBlock("```file\nsource code\n")
 	expect = []blockElement{
 		{
+			line:     1,
+			endLine:  3,
 			kind:     blockElementKindCodeBlock,
-			codeName: "file",
+			codeInfo: codeBlockInfo{language: "file"},
 			codeText: "source code\n",
 		},
 	}
 	test.AssertEquals(t, got, expect)
 
+	got = parseBlock("```go:main.go {1,3-4} showLineNumbers\nsource code\n```")
+	expect = []blockElement{
+		{
+			line:    1,
+			endLine: 3,
+			kind:    blockElementKindCodeBlock,
+			codeInfo: codeBlockInfo{
+				language:        "go",
+				fileName:        "main.go",
+				highlightLines:  [][2]int{{1, 1}, {3, 4}},
+				showLineNumbers: true,
+			},
+			codeText: "source code",
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
 	// トグル (HTML)
 	got = parseBlock(`<details>
 <summary>Summary</summary>
@@ -183,33 +343,42 @@ Hello, world!
 </details>`)
 	expect = []blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "Summary",
-			detailsContentHTML: "<p>Hello, world!</p><ul><li>list</li><li>list</li></ul>",
+			line:           1,
+			endLine:        6,
+			kind:           blockElementDetails,
+			detailsSummary: "Summary",
 		},
 	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p><ul><li>list</li><li>list</li></ul>")
+	got[0].blocks = nil
 	test.AssertEquals(t, got, expect)
 	got = parseBlock(`<details>
 Hello, world!
 </details>`)
 	expect = []blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "",
-			detailsContentHTML: "<p>Hello, world!</p>",
+			line:           1,
+			endLine:        3,
+			kind:           blockElementDetails,
+			detailsSummary: "",
 		},
 	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p>")
+	got[0].blocks = nil
 	test.AssertEquals(t, got, expect)
 	got = parseBlock(`<details>
 <summary>summary</summary>
 Hello, world!`)
 	expect = []blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "summary",
-			detailsContentHTML: "<p>Hello, world!</p>",
+			line:           1,
+			endLine:        3,
+			kind:           blockElementDetails,
+			detailsSummary: "summary",
 		},
 	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p>")
+	got[0].blocks = nil
 	test.AssertEquals(t, got, expect)
 
 	// トグル (カスタム)
@@ -220,20 +389,174 @@ Hello, world!
 :::`)
 	expect = []blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "Summary",
-			detailsContentHTML: "<p>Hello, world!</p><ul><li>list</li><li>list</li></ul>",
+			line:           1,
+			endLine:        5,
+			kind:           blockElementDetails,
+			detailsSummary: "Summary",
 		},
 	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p><ul><li>list</li><li>list</li></ul>")
+	got[0].blocks = nil
 	test.AssertEquals(t, got, expect)
 	got = parseBlock(`:::details summary
 Hello, world!`)
 	expect = []blockElement{
 		{
-			kind:               blockElementDetails,
-			detailsSummary:     "summary",
-			detailsContentHTML: "<p>Hello, world!</p>",
+			line:           1,
+			endLine:        2,
+			kind:           blockElementDetails,
+			detailsSummary: "summary",
+		},
+	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p>")
+	got[0].blocks = nil
+	test.AssertEquals(t, got, expect)
+
+	// テーブル
+	got = parseBlock(`| inline | inline |
+|:--|--:|
+| inline |`)
+	expect = []blockElement{
+		{
+			line:            1,
+			endLine:         3,
+			kind:            blockElementKindTable,
+			tableHeader:     []inlineElement{inline, inline},
+			tableAlignments: []tableAlignment{tableAlignmentLeft, tableAlignmentRight},
+			tableRows: [][]inlineElement{
+				{inline, {kind: inlineElementKindRoot}},
+			},
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// 区切り行が無ければテーブルではない
+	got = parseBlock(`| inline |`)
+	expect = []blockElement{
+		{
+			line:    1,
+			endLine: 1,
+			kind:    blockElementKindParagraph,
+			children: inlineElement{
+				kind: inlineElementKindRoot,
+				children: []inlineElement{
+					{
+						kind: inlineElementKindRoot,
+						children: []inlineElement{
+							{kind: inlineElementKindText, s: "|"},
+							{kind: inlineElementKindText, s: " inline "},
+							{kind: inlineElementKindText, s: "|"},
+						},
+					},
+				},
+			},
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// 引用
+	got = parseBlock(`> inline
+>
+> - list
+> > nested
+inline`)
+	expect = []blockElement{
+		{
+			line:    1,
+			endLine: 4,
+			kind:    blockElementKindBlockquote,
+		},
+		{
+			line:     5,
+			endLine:  5,
+			kind:     blockElementKindParagraph,
+			children: doubleRootInline,
+		},
+	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>inline</p><ul><li>list</li></ul><blockquote><p>nested</p></blockquote>")
+	// 入れ子の要素も元の文書での行番号を持つ
+	test.AssertEquals(t, got[0].blocks[0].line, 1)
+	test.AssertEquals(t, got[0].blocks[2].line, 3)
+	test.AssertEquals(t, got[0].blocks[3].line, 4)
+	test.AssertEquals(t, got[0].blocks[3].blocks[0].line, 4)
+	got[0].blocks = nil
+	test.AssertEquals(t, got, expect)
+
+	// コールアウト
+	got = parseBlock(`:::warning 注意
+Hello, world!
+:::note
+nested
+:::
+:::
+inline`)
+	expect = []blockElement{
+		{
+			line:         1,
+			endLine:      6,
+			kind:         blockElementKindCallout,
+			calloutKind:  "warning",
+			calloutTitle: "注意",
+		},
+		{
+			line:     7,
+			endLine:  7,
+			kind:     blockElementKindParagraph,
+			children: doubleRootInline,
 		},
 	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<p>Hello, world!</p><aside class=\"callout callout-note\"><p>nested</p></aside>")
+	got[0].blocks = nil
 	test.AssertEquals(t, got, expect)
+
+	// コールアウト中のトグル
+	got = parseBlock(`:::tip
+:::details summary
+details
+:::
+:::`)
+	expect = []blockElement{
+		{
+			line:        1,
+			endLine:     5,
+			kind:        blockElementKindCallout,
+			calloutKind: "tip",
+		},
+	}
+	test.AssertEquals(t, blockElementsToHTML(got[0].blocks), "<details><summary>summary</summary><p>details</p></details>")
+	got[0].blocks = nil
+	test.AssertEquals(t, got, expect)
+}
+
+func TestReadLines(t *testing.T) {
+	for _, s := range []string{"", "a", "a\n", "a\nb", "a\n\nb\n\n", "\n", "日本語\r\nです"} {
+		got, err := readLines(iotest.OneByteReader(strings.NewReader(s)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEquals(t, got, strings.Split(s, "\n"))
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRender(t *testing.T) {
+	src := "# title\n\n- list\n\ntext[^1]\n\n[^1]: note"
+
+	var b bytes.Buffer
+	if err := Render(&b, iotest.HalfReader(strings.NewReader(src))); err != nil {
+		t.Fatal(err)
+	}
+	test.AssertSame(t, b.String(), ToHTML(src))
+
+	readErr := errors.New("read failed")
+	test.AssertEquals(t, Render(&b, iotest.ErrReader(readErr)), readErr)
+
+	if err := Render(failingWriter{}, strings.NewReader(src)); err == nil {
+		t.Fatal("expected write error")
+	}
 }
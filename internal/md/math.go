@@ -0,0 +1,294 @@
+package md
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// LaTeX の数式の一部を MathML に変換する。
+// 対応していないコマンドは <merror> として出力する。
+func latexToMathML(src string, display bool) string {
+	p := &mathParser{s: []rune(src), display: display}
+	body := p.parseRow(0)
+
+	if display {
+		return "<math display=\"block\"><mrow>" + body + "</mrow></math>"
+	}
+	return "<math><mrow>" + body + "</mrow></math>"
+}
+
+var (
+	mathIdentifiers = map[string]string{
+		"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+		"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+		"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "rho": "ρ", "sigma": "σ",
+		"tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+		"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+		"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+		"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "hbar": "ℏ", "ell": "ℓ",
+	}
+
+	mathOperators = map[string]string{
+		"times": "×", "cdot": "⋅", "pm": "±", "mp": "∓", "div": "÷", "ast": "∗", "star": "⋆", "circ": "∘",
+		"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+		"equiv": "≡", "sim": "∼", "simeq": "≃", "propto": "∝", "ll": "≪", "gg": "≫",
+		"to": "→", "rightarrow": "→", "leftarrow": "←", "Rightarrow": "⇒", "Leftarrow": "⇐",
+		"leftrightarrow": "↔", "Leftrightarrow": "⇔", "iff": "⟺", "implies": "⟹", "mapsto": "↦",
+		"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+		"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "forall": "∀", "exists": "∃",
+		"neg": "¬", "lnot": "¬", "land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨",
+		"oplus": "⊕", "otimes": "⊗", "perp": "⊥", "parallel": "∥", "mid": "∣", "angle": "∠",
+		"ldots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "prime": "′",
+		"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+		"{": "{", "}": "}", "|": "‖",
+	}
+
+	// 添字を上下に置く大きな演算子
+	mathLargeOperators = map[string]string{
+		"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "oint": "∮",
+		"bigcup": "⋃", "bigcap": "⋂",
+	}
+
+	mathFunctions = words("sin cos tan sec csc cot arcsin arccos arctan sinh cosh tanh log ln lg exp " +
+		"max min sup inf det dim ker gcd deg arg Pr")
+
+	// lim のように、ディスプレイ数式では添字を下に置く関数
+	mathLimits = words("lim limsup liminf max min sup inf")
+
+	mathSpaces = map[string]string{
+		",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", " ": "0.25em",
+		"quad": "1em", "qquad": "2em",
+	}
+
+	mathAccents = map[string]string{
+		"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→", "dot": "˙",
+		"ddot": "¨", "tilde": "~", "widetilde": "~",
+	}
+
+	mathVariants = map[string]string{
+		"mathrm": "normal", "mathbf": "bold", "mathit": "italic", "mathsf": "sans-serif",
+		"mathtt": "monospace", "mathbb": "double-struck", "mathcal": "script", "boldsymbol": "bold-italic",
+	}
+)
+
+type mathParser struct {
+	s       []rune
+	i       int
+	display bool
+}
+
+func (p *mathParser) skipSpaces() {
+	for p.i < len(p.s) && unicode.IsSpace(p.s[p.i]) {
+		p.i++
+	}
+}
+
+// closing が現れるか末尾に達するまでの要素を、添字を含めて変換する
+func (p *mathParser) parseRow(closing rune) string {
+	ret := ""
+	for {
+		p.skipSpaces()
+		if p.i >= len(p.s) || (closing != 0 && p.s[p.i] == closing) {
+			return ret
+		}
+
+		base, limits := p.parseAtom()
+
+		var sub, sup string
+		hasSub, hasSup := false, false
+		for {
+			p.skipSpaces()
+			if p.i >= len(p.s) {
+				break
+			}
+			if p.s[p.i] == '_' && !hasSub {
+				p.i++
+				sub, _ = p.parseAtom()
+				hasSub = true
+				continue
+			}
+			if p.s[p.i] == '^' && !hasSup {
+				p.i++
+				sup, _ = p.parseAtom()
+				hasSup = true
+				continue
+			}
+			if p.s[p.i] == '\'' && !hasSup {
+				p.i++
+				sup = "<mo>′</mo>"
+				hasSup = true
+				continue
+			}
+			break
+		}
+
+		under, over, both := "msub", "msup", "msubsup"
+		if limits && p.display {
+			under, over, both = "munder", "mover", "munderover"
+		}
+
+		switch {
+		case hasSub && hasSup:
+			ret += "<" + both + ">" + base + sub + sup + "</" + both + ">"
+		case hasSub:
+			ret += "<" + under + ">" + base + sub + "</" + under + ">"
+		case hasSup:
+			ret += "<" + over + ">" + base + sup + "</" + over + ">"
+		default:
+			ret += base
+		}
+	}
+}
+
+// 一つの要素を変換する。limits は添字を上下に置く要素かどうか。
+func (p *mathParser) parseAtom() (s string, limits bool) {
+	p.skipSpaces()
+	if p.i >= len(p.s) {
+		return "<mrow></mrow>", false
+	}
+
+	c := p.s[p.i]
+
+	switch {
+	case c == '{':
+		p.i++
+		inner := p.parseRow('}')
+		if p.i < len(p.s) {
+			p.i++
+		}
+		return "<mrow>" + inner + "</mrow>", false
+	case c == '\\':
+		p.i++
+		return p.parseCommand()
+	case unicode.IsDigit(c):
+		j := p.i
+		for j < len(p.s) && (unicode.IsDigit(p.s[j]) || (p.s[j] == '.' && j+1 < len(p.s) && unicode.IsDigit(p.s[j+1]))) {
+			j++
+		}
+		n := string(p.s[p.i:j])
+		p.i = j
+		return "<mn>" + n + "</mn>", false
+	case c < unicode.MaxASCII && unicode.IsLetter(c):
+		p.i++
+		return "<mi>" + string(c) + "</mi>", false
+	case unicode.IsLetter(c):
+		// 日本語などは文字列として扱う
+		j := p.i
+		for j < len(p.s) && unicode.IsLetter(p.s[j]) && p.s[j] > unicode.MaxASCII {
+			j++
+		}
+		t := string(p.s[p.i:j])
+		p.i = j
+		return "<mtext>" + html.EscapeString(t) + "</mtext>", false
+	}
+
+	p.i++
+	return "<mo>" + html.EscapeString(string(c)) + "</mo>", false
+}
+
+// 引数を {} の中身の文字列として取り出す
+func (p *mathParser) readRawArgument() string {
+	p.skipSpaces()
+	if p.i >= len(p.s) || p.s[p.i] != '{' {
+		return ""
+	}
+
+	depth := 0
+	start := p.i + 1
+	for ; p.i < len(p.s); p.i++ {
+		switch p.s[p.i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				ret := string(p.s[start:p.i])
+				p.i++
+				return ret
+			}
+		}
+	}
+	return string(p.s[start:])
+}
+
+func (p *mathParser) parseCommand() (string, bool) {
+	if p.i >= len(p.s) {
+		return "<mo>\\</mo>", false
+	}
+
+	// \alpha のような英字のコマンドと、\, のような 1 文字のコマンドがある
+	j := p.i
+	for j < len(p.s) && p.s[j] < unicode.MaxASCII && unicode.IsLetter(p.s[j]) {
+		j++
+	}
+	if j == p.i {
+		j++
+	}
+	name := string(p.s[p.i:j])
+	p.i = j
+
+	if v, ok := mathIdentifiers[name]; ok {
+		return "<mi>" + v + "</mi>", false
+	}
+	if v, ok := mathOperators[name]; ok {
+		return "<mo>" + html.EscapeString(v) + "</mo>", false
+	}
+	if v, ok := mathLargeOperators[name]; ok {
+		return "<mo largeop=\"true\">" + v + "</mo>", true
+	}
+	if mathFunctions[name] || mathLimits[name] {
+		return "<mi>" + name + "</mi>", mathLimits[name]
+	}
+	if v, ok := mathSpaces[name]; ok {
+		return "<mspace width=\"" + v + "\"></mspace>", false
+	}
+	if v, ok := mathAccents[name]; ok {
+		base, _ := p.parseAtom()
+		return "<mover accent=\"true\">" + base + "<mo>" + v + "</mo></mover>", false
+	}
+	if v, ok := mathVariants[name]; ok {
+		return "<mstyle mathvariant=\"" + v + "\">" + latexToMathMLRow(p.readRawArgument(), p.display) + "</mstyle>", false
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac":
+		num, _ := p.parseAtom()
+		den, _ := p.parseAtom()
+		return "<mfrac>" + num + den + "</mfrac>", false
+	case "sqrt":
+		p.skipSpaces()
+		if p.i < len(p.s) && p.s[p.i] == '[' {
+			p.i++
+			index := p.parseRow(']')
+			if p.i < len(p.s) {
+				p.i++
+			}
+			base, _ := p.parseAtom()
+			return "<mroot>" + base + "<mrow>" + index + "</mrow></mroot>", false
+		}
+		base, _ := p.parseAtom()
+		return "<msqrt>" + base + "</msqrt>", false
+	case "text", "textrm", "mbox":
+		return "<mtext>" + html.EscapeString(p.readRawArgument()) + "</mtext>", false
+	case "operatorname":
+		return "<mi>" + html.EscapeString(p.readRawArgument()) + "</mi>", false
+	case "left", "right", "big", "Big", "bigl", "bigr", "Bigl", "Bigr":
+		p.skipSpaces()
+		if p.i < len(p.s) && p.s[p.i] == '.' {
+			p.i++
+			return "", false
+		}
+		d, _ := p.parseAtom()
+		return strings.Replace(d, "<mo>", "<mo stretchy=\"true\">", 1), false
+	case "!", "\\":
+		return "", false
+	}
+
+	return "<merror><mtext>" + html.EscapeString("\\"+name) + "</mtext></merror>", false
+}
+
+func latexToMathMLRow(src string, display bool) string {
+	p := &mathParser{s: []rune(src), display: display}
+	return p.parseRow(0)
+}
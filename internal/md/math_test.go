@@ -0,0 +1,60 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestLatexToMathML(t *testing.T) {
+	test.AssertSame(
+		t,
+		latexToMathML(`x_i^2 + \alpha`, false),
+		"<math><mrow><msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup><mo>+</mo><mi>α</mi></mrow></math>",
+	)
+
+	test.AssertSame(
+		t,
+		latexToMathML(`\frac{1}{\sqrt{2}}`, false),
+		"<math><mrow><mfrac><mrow><mn>1</mn></mrow><mrow><msqrt><mrow><mn>2</mn></mrow></msqrt></mrow></mfrac></mrow></math>",
+	)
+
+	// ディスプレイ数式では、大きな演算子の添字を上下に置く
+	test.AssertSame(
+		t,
+		latexToMathML(`\sum_{i=1}^n`, true),
+		"<math display=\"block\"><mrow><munderover><mo largeop=\"true\">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover></mrow></math>",
+	)
+	test.AssertSame(
+		t,
+		latexToMathML(`\sum_{i}`, false),
+		"<math><mrow><msub><mo largeop=\"true\">∑</mo><mrow><mi>i</mi></mrow></msub></mrow></math>",
+	)
+
+	test.AssertSame(
+		t,
+		latexToMathML(`\text{速度 <v>} \unknown`, false),
+		"<math><mrow><mtext>速度 &lt;v&gt;</mtext><merror><mtext>\\unknown</mtext></merror></mrow></math>",
+	)
+
+	// 閉じ括弧が無くても末尾で閉じる
+	test.AssertSame(
+		t,
+		latexToMathML(`{a`, false),
+		"<math><mrow><mrow><mi>a</mi></mrow></mrow></math>",
+	)
+}
+
+func TestMathInMarkdown(t *testing.T) {
+	test.AssertSame(
+		t,
+		ToHTML(`$5 and $10 $a_b$`),
+		"<p>$5 and $10 <math><mrow><msub><mi>a</mi><mi>b</mi></msub></mrow></math></p>",
+	)
+
+	test.AssertSame(
+		t,
+		ToHTML("$$\na\n$$\n$$b$$"),
+		"<math display=\"block\"><mrow><mi>a</mi></mrow></math><math display=\"block\"><mrow><mi>b</mi></mrow></math>",
+	)
+}
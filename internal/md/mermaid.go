@@ -0,0 +1,694 @@
+package md
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	errMermaidUnknownDiagram = errors.New("unknown mermaid diagram type")
+	errMermaidEmpty          = errors.New("mermaid diagram is empty")
+)
+
+// Mermaid のフローチャートとシーケンス図の一部を SVG に変換する
+func renderMermaid(src string) (string, error) {
+	var lines []string
+	for _, l := range strings.Split(src, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "%%") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if len(lines) == 0 {
+		return "", errMermaidEmpty
+	}
+
+	header := strings.Fields(lines[0])
+	switch header[0] {
+	case "flowchart", "graph":
+		direction := "TD"
+		if len(header) > 1 {
+			direction = header[1]
+		}
+		f, err := parseFlowchart(direction, lines[1:])
+		if err != nil {
+			return "", err
+		}
+		return flowchartToSVG(f, diagramIDPrefix(src)), nil
+	case "sequenceDiagram":
+		d, err := parseSequenceDiagram(lines[1:])
+		if err != nil {
+			return "", err
+		}
+		return sequenceDiagramToSVG(d, diagramIDPrefix(src)), nil
+	}
+
+	return "", errMermaidUnknownDiagram
+}
+
+// === フローチャート ===
+
+type flowchartShape int
+
+const (
+	flowchartShapeRect flowchartShape = iota
+	flowchartShapeRound
+	flowchartShapeDiamond
+	flowchartShapeCircle
+)
+
+type flowchartNode struct {
+	id    string
+	label string
+	shape flowchartShape
+}
+
+type flowchartEdgeStyle int
+
+const (
+	flowchartEdgeStyleSolid flowchartEdgeStyle = iota
+	flowchartEdgeStyleDotted
+	flowchartEdgeStyleThick
+)
+
+type flowchartEdge struct {
+	from  string
+	to    string
+	label string
+	arrow bool
+	style flowchartEdgeStyle
+}
+
+type flowchart struct {
+	// TD, TB, BT, LR, RL のいずれか
+	direction string
+	nodes     []flowchartNode
+	edges     []flowchartEdge
+}
+
+var (
+	flowchartNodeIDPattern       = regexp.MustCompile(`^[\p{L}\p{N}_]+`)
+	flowchartEdgePattern         = regexp.MustCompile(`^\s*(-->|---|-\.->|-\.-|==>|===)\s*(?:\|([^|]*)\|)?\s*`)
+	flowchartEdgeWithTextPattern = regexp.MustCompile(`^\s*(--|==|-\.)\s+([^|]+?)\s+(-->|---|\.->|\.-|==>|===)\s*`)
+)
+
+func parseFlowchart(direction string, lines []string) (*flowchart, error) {
+	switch direction {
+	case "TD", "TB", "BT", "LR", "RL":
+	default:
+		return nil, fmt.Errorf("unknown flowchart direction %q", direction)
+	}
+
+	f := &flowchart{direction: direction}
+	index := make(map[string]int)
+
+	addNode := func(n flowchartNode, hasShape bool) {
+		i, ok := index[n.id]
+		if !ok {
+			index[n.id] = len(f.nodes)
+			f.nodes = append(f.nodes, n)
+			return
+		}
+		// 形が後から指定されたときは上書きする
+		if hasShape {
+			f.nodes[i] = n
+		}
+	}
+
+	for _, line := range lines {
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if stmt == "" {
+				continue
+			}
+
+			// 見た目の指定は無視する
+			first := strings.Fields(stmt)[0]
+			switch first {
+			case "classDef", "class", "style", "linkStyle", "click":
+				continue
+			case "subgraph", "end", "direction":
+				return nil, fmt.Errorf("unsupported flowchart statement %q", first)
+			}
+
+			n, hasShape, rest, err := parseFlowchartNode(stmt)
+			if err != nil {
+				return nil, err
+			}
+			addNode(n, hasShape)
+
+			from := n.id
+			for strings.TrimSpace(rest) != "" {
+				var e flowchartEdge
+				e, rest, err = parseFlowchartEdge(rest)
+				if err != nil {
+					return nil, err
+				}
+
+				to, hasShape, r, err := parseFlowchartNode(strings.TrimLeftFunc(rest, unicode.IsSpace))
+				if err != nil {
+					return nil, err
+				}
+				addNode(to, hasShape)
+				rest = r
+
+				e.from = from
+				e.to = to.id
+				f.edges = append(f.edges, e)
+				from = to.id
+			}
+		}
+	}
+
+	if len(f.nodes) == 0 {
+		return nil, errMermaidEmpty
+	}
+
+	return f, nil
+}
+
+func parseFlowchartNode(s string) (n flowchartNode, hasShape bool, rest string, err error) {
+	id := flowchartNodeIDPattern.FindString(s)
+	if id == "" {
+		return n, false, "", fmt.Errorf("invalid flowchart node %q", s)
+	}
+	n = flowchartNode{id: id, label: id}
+	s = s[len(id):]
+
+	shapes := []struct {
+		open, close string
+		shape       flowchartShape
+	}{
+		{"((", "))", flowchartShapeCircle},
+		{"(", ")", flowchartShapeRound},
+		{"[", "]", flowchartShapeRect},
+		{"{", "}", flowchartShapeDiamond},
+		{">", "]", flowchartShapeRect},
+	}
+	for _, sh := range shapes {
+		if !strings.HasPrefix(s, sh.open) {
+			continue
+		}
+		end := strings.Index(s[len(sh.open):], sh.close)
+		if end < 0 {
+			return n, false, "", fmt.Errorf("unclosed flowchart node %q", id)
+		}
+		label := strings.TrimSpace(s[len(sh.open) : len(sh.open)+end])
+		label = strings.Trim(label, "\"")
+
+		n.label = label
+		n.shape = sh.shape
+		return n, true, s[len(sh.open)+end+len(sh.close):], nil
+	}
+
+	return n, false, s, nil
+}
+
+func parseFlowchartEdge(s string) (e flowchartEdge, rest string, err error) {
+	op := ""
+	if m := flowchartEdgePattern.FindStringSubmatch(s); len(m) > 0 {
+		op = m[1]
+		e.label = strings.TrimSpace(m[2])
+		rest = s[len(m[0]):]
+	} else if m := flowchartEdgeWithTextPattern.FindStringSubmatch(s); len(m) > 0 {
+		op = m[1] + m[3]
+		e.label = m[2]
+		rest = s[len(m[0]):]
+	} else {
+		return e, "", fmt.Errorf("invalid flowchart edge %q", s)
+	}
+
+	e.arrow = strings.HasSuffix(op, ">")
+	switch {
+	case strings.Contains(op, "."):
+		e.style = flowchartEdgeStyleDotted
+	case strings.Contains(op, "="):
+		e.style = flowchartEdgeStyleThick
+	}
+
+	return e, rest, nil
+}
+
+// 各ノードの階層を求める。閉路があるときは、深さ優先探索で戻る辺を無視する。
+func flowchartRanks(f *flowchart) map[string]int {
+	adjacent := make(map[string][]int)
+	for i, e := range f.edges {
+		adjacent[e.from] = append(adjacent[e.from], i)
+	}
+
+	backEdges := make(map[int]bool)
+	state := make(map[string]int) // 0: 未訪問, 1: 探索中, 2: 探索済み
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = 1
+		for _, i := range adjacent[id] {
+			to := f.edges[i].to
+			switch state[to] {
+			case 0:
+				visit(to)
+			case 1:
+				backEdges[i] = true
+			}
+		}
+		state[id] = 2
+	}
+	for _, n := range f.nodes {
+		if state[n.id] == 0 {
+			visit(n.id)
+		}
+	}
+
+	ranks := make(map[string]int)
+	for range f.nodes {
+		changed := false
+		for i, e := range f.edges {
+			if backEdges[i] || e.from == e.to {
+				continue
+			}
+			if ranks[e.to] < ranks[e.from]+1 {
+				ranks[e.to] = ranks[e.from] + 1
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	return ranks
+}
+
+type flowchartBox struct {
+	x, y, w, h float64
+	shape      flowchartShape
+}
+
+// 中心から (dx, dy) の方向に伸ばした線と、ノードの輪郭の交点を求める
+func (b flowchartBox) clip(dx, dy float64) (float64, float64) {
+	if dx == 0 && dy == 0 {
+		return b.x, b.y
+	}
+	hw, hh := b.w/2, b.h/2
+
+	var t float64
+	switch b.shape {
+	case flowchartShapeDiamond:
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	case flowchartShapeCircle:
+		t = 1 / math.Sqrt((dx/hw)*(dx/hw)+(dy/hh)*(dy/hh))
+	default:
+		t = math.Inf(1)
+		if dx != 0 {
+			t = hw / math.Abs(dx)
+		}
+		if dy != 0 {
+			t = min(t, hh/math.Abs(dy))
+		}
+	}
+
+	return b.x + dx*t, b.y + dy*t
+}
+
+func flowchartToSVG(f *flowchart, prefix string) string {
+	ranks := flowchartRanks(f)
+
+	maxRank := 0
+	for _, r := range ranks {
+		maxRank = max(maxRank, r)
+	}
+
+	layers := make([][]int, maxRank+1)
+	for i, n := range f.nodes {
+		layers[ranks[n.id]] = append(layers[ranks[n.id]], i)
+	}
+	maxCount := 0
+	for _, l := range layers {
+		maxCount = max(maxCount, len(l))
+	}
+
+	boxes := make([]flowchartBox, len(f.nodes))
+	maxWidth := 0.0
+	for i, n := range f.nodes {
+		w := max(estimateTextWidth(n.label)+24, 60)
+		h := diagramNodeHeight
+		switch n.shape {
+		case flowchartShapeDiamond:
+			w += 24
+			h += 16
+		case flowchartShapeCircle:
+			w = max(w, h)
+			h = w
+		}
+		boxes[i] = flowchartBox{w: w, h: h, shape: n.shape}
+		maxWidth = max(maxWidth, w)
+	}
+	maxHeight := 0.0
+	for _, b := range boxes {
+		maxHeight = max(maxHeight, b.h)
+	}
+
+	horizontal := f.direction == "LR" || f.direction == "RL"
+	reversed := f.direction == "BT" || f.direction == "RL"
+
+	// main は階層の方向、cross はそれと直交する方向
+	mainCell, crossCell := maxHeight+48, maxWidth+32
+	if horizontal {
+		mainCell, crossCell = maxWidth+64, maxHeight+24
+	}
+
+	for r, layer := range layers {
+		if reversed {
+			r = maxRank - r
+		}
+		for k, i := range layer {
+			main := diagramMargin + float64(r)*mainCell + mainCell/2
+			cross := diagramMargin + (float64(k)+float64(maxCount-len(layer))/2)*crossCell + crossCell/2
+			if horizontal {
+				boxes[i].x, boxes[i].y = main, cross
+			} else {
+				boxes[i].x, boxes[i].y = cross, main
+			}
+		}
+	}
+
+	width := 2*diagramMargin + float64(maxCount)*crossCell
+	height := 2*diagramMargin + float64(maxRank+1)*mainCell
+	if horizontal {
+		width, height = height, width
+	}
+
+	index := make(map[string]int)
+	for i, n := range f.nodes {
+		index[n.id] = i
+	}
+
+	var ret strings.Builder
+	ret.WriteString(svgStart("diagram-flowchart", width, height) + svgMarkers(prefix))
+
+	var labels strings.Builder
+	for _, e := range f.edges {
+		a, b := boxes[index[e.from]], boxes[index[e.to]]
+
+		attr := " stroke=\"#333\" fill=\"none\""
+		switch e.style {
+		case flowchartEdgeStyleDotted:
+			attr += " stroke-dasharray=\"4 4\""
+		case flowchartEdgeStyleThick:
+			attr += " stroke-width=\"3\""
+		}
+		if e.arrow {
+			attr += " marker-end=\"url(#" + prefix + "-arrow)\""
+		}
+
+		if e.from == e.to {
+			// 自分自身への辺は、右側に輪を描く
+			x, y := a.x+a.w/2, a.y
+			fmt.Fprintf(&ret, "<path d=\"M %s %s c 24 -24 24 24 0 8\"%s></path>", formatSVGNumber(x), formatSVGNumber(y-4), attr)
+			if e.label != "" {
+				labels.WriteString(svgLabel(x+24+estimateTextWidth(e.label)/2, y, e.label))
+			}
+			continue
+		}
+
+		dx, dy := b.x-a.x, b.y-a.y
+		x1, y1 := a.clip(dx, dy)
+		x2, y2 := b.clip(-dx, -dy)
+		fmt.Fprintf(&ret,
+			"<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"%s></line>",
+			formatSVGNumber(x1), formatSVGNumber(y1), formatSVGNumber(x2), formatSVGNumber(y2), attr,
+		)
+		if e.label != "" {
+			labels.WriteString(svgLabel((x1+x2)/2, (y1+y2)/2, e.label))
+		}
+	}
+	ret.WriteString(labels.String())
+
+	for i, n := range f.nodes {
+		b := boxes[i]
+		shapeAttr := " fill=\"#eef\" stroke=\"#336\""
+		switch n.shape {
+		case flowchartShapeRect, flowchartShapeRound:
+			rx := 0.0
+			if n.shape == flowchartShapeRound {
+				rx = 12
+			}
+			fmt.Fprintf(&ret,
+				"<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" rx=\"%s\"%s></rect>",
+				formatSVGNumber(b.x-b.w/2), formatSVGNumber(b.y-b.h/2), formatSVGNumber(b.w), formatSVGNumber(b.h), formatSVGNumber(rx), shapeAttr,
+			)
+		case flowchartShapeDiamond:
+			fmt.Fprintf(&ret,
+				"<polygon points=\"%s,%s %s,%s %s,%s %s,%s\"%s></polygon>",
+				formatSVGNumber(b.x), formatSVGNumber(b.y-b.h/2),
+				formatSVGNumber(b.x+b.w/2), formatSVGNumber(b.y),
+				formatSVGNumber(b.x), formatSVGNumber(b.y+b.h/2),
+				formatSVGNumber(b.x-b.w/2), formatSVGNumber(b.y),
+				shapeAttr,
+			)
+		case flowchartShapeCircle:
+			fmt.Fprintf(&ret,
+				"<ellipse cx=\"%s\" cy=\"%s\" rx=\"%s\" ry=\"%s\"%s></ellipse>",
+				formatSVGNumber(b.x), formatSVGNumber(b.y), formatSVGNumber(b.w/2), formatSVGNumber(b.h/2), shapeAttr,
+			)
+		}
+		ret.WriteString(svgText(b.x, b.y, n.label))
+	}
+
+	ret.WriteString("</svg>")
+	return ret.String()
+}
+
+// === シーケンス図 ===
+
+type sequenceParticipant struct {
+	id    string
+	label string
+}
+
+type sequenceArrow int
+
+const (
+	sequenceArrowNone sequenceArrow = iota
+	sequenceArrowFilled
+	sequenceArrowCross
+	sequenceArrowOpen
+)
+
+type sequenceEvent struct {
+	// メッセージのとき from と to、ノートのとき from と to に対象の参加者が入る
+	from    string
+	to      string
+	text    string
+	isNote  bool
+	dashed  bool
+	arrow   sequenceArrow
+	notePos string // "left of", "right of", "over"
+}
+
+type sequenceDiagram struct {
+	participants []sequenceParticipant
+	events       []sequenceEvent
+}
+
+var (
+	sequenceParticipantPattern = regexp.MustCompile(`^(?:participant|actor)\s+(\S+?)(?:\s+as\s+(.+))?$`)
+	sequenceMessagePattern     = regexp.MustCompile(`^([^\s:>-]+)\s*(-->>|->>|--x|-x|--\)|-\)|-->|->)\s*[+-]?([^\s:>-]+)\s*:\s*(.*)$`)
+	sequenceNotePattern        = regexp.MustCompile(`^[Nn]ote\s+(left of|right of|over)\s+([^\s:,]+)(?:\s*,\s*([^\s:,]+))?\s*:\s*(.*)$`)
+)
+
+func parseSequenceDiagram(lines []string) (*sequenceDiagram, error) {
+	d := &sequenceDiagram{}
+	known := make(map[string]bool)
+
+	addParticipant := func(id, label string) {
+		if known[id] {
+			return
+		}
+		known[id] = true
+		if label == "" {
+			label = id
+		}
+		d.participants = append(d.participants, sequenceParticipant{id: id, label: label})
+	}
+
+	for _, l := range lines {
+		first := strings.Fields(l)[0]
+		switch first {
+		case "autonumber", "activate", "deactivate", "title":
+			continue
+		case "loop", "alt", "else", "opt", "par", "and", "critical", "break", "rect", "end", "box":
+			return nil, fmt.Errorf("unsupported sequence diagram statement %q", first)
+		}
+
+		if m := sequenceParticipantPattern.FindStringSubmatch(l); len(m) > 0 {
+			addParticipant(m[1], strings.TrimSpace(m[2]))
+			continue
+		}
+
+		if m := sequenceMessagePattern.FindStringSubmatch(l); len(m) > 0 {
+			addParticipant(m[1], "")
+			addParticipant(m[3], "")
+
+			e := sequenceEvent{from: m[1], to: m[3], text: m[4], dashed: strings.HasPrefix(m[2], "--")}
+			switch strings.TrimLeft(m[2], "-") {
+			case ">>":
+				e.arrow = sequenceArrowFilled
+			case "x":
+				e.arrow = sequenceArrowCross
+			case ")":
+				e.arrow = sequenceArrowOpen
+			}
+			d.events = append(d.events, e)
+			continue
+		}
+
+		if m := sequenceNotePattern.FindStringSubmatch(l); len(m) > 0 {
+			to := m[3]
+			if to == "" {
+				to = m[2]
+			}
+			addParticipant(m[2], "")
+			addParticipant(to, "")
+
+			d.events = append(d.events, sequenceEvent{from: m[2], to: to, text: m[4], isNote: true, notePos: m[1]})
+			continue
+		}
+
+		return nil, fmt.Errorf("invalid sequence diagram statement %q", l)
+	}
+
+	if len(d.participants) == 0 {
+		return nil, errMermaidEmpty
+	}
+
+	return d, nil
+}
+
+func sequenceDiagramToSVG(d *sequenceDiagram, prefix string) string {
+	colWidth := 120.0
+	for _, p := range d.participants {
+		colWidth = max(colWidth, estimateTextWidth(p.label)+48)
+	}
+	for _, e := range d.events {
+		if !e.isNote && e.from != e.to {
+			colWidth = max(colWidth, estimateTextWidth(e.text)+32)
+		}
+	}
+
+	x := make(map[string]float64)
+	for i, p := range d.participants {
+		x[p.id] = diagramMargin + float64(i)*colWidth + colWidth/2
+	}
+
+	const headerHeight = 36.0
+	const rowHeight = 40.0
+
+	// 先に各イベントの高さを求めて、全体の大きさを決める
+	y := diagramMargin + headerHeight + 16
+	rows := make([]float64, len(d.events))
+	extraRight := 0.0
+	for i, e := range d.events {
+		y += rowHeight
+		if !e.isNote && e.from == e.to {
+			y += 16
+		}
+		rows[i] = y
+
+		if e.isNote && e.notePos == "right of" && e.from == d.participants[len(d.participants)-1].id {
+			extraRight = max(extraRight, estimateTextWidth(e.text)+24-colWidth/2+8)
+		}
+		if !e.isNote && e.from == e.to && e.from == d.participants[len(d.participants)-1].id {
+			extraRight = max(extraRight, estimateTextWidth(e.text)+48-colWidth/2)
+		}
+	}
+	bottom := y + 24
+
+	width := 2*diagramMargin + float64(len(d.participants))*colWidth + extraRight
+	height := bottom + headerHeight + diagramMargin
+
+	var ret strings.Builder
+	ret.WriteString(svgStart("diagram-sequence", width, height) + svgMarkers(prefix))
+
+	for _, p := range d.participants {
+		fmt.Fprintf(&ret,
+			"<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"#999\"></line>",
+			formatSVGNumber(x[p.id]), formatSVGNumber(diagramMargin+headerHeight),
+			formatSVGNumber(x[p.id]), formatSVGNumber(bottom),
+		)
+		for _, top := range []float64{diagramMargin, bottom} {
+			w := colWidth - 24
+			fmt.Fprintf(&ret,
+				"<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"#eef\" stroke=\"#336\"></rect>",
+				formatSVGNumber(x[p.id]-w/2), formatSVGNumber(top), formatSVGNumber(w), formatSVGNumber(headerHeight),
+			)
+			ret.WriteString(svgText(x[p.id], top+headerHeight/2, p.label))
+		}
+	}
+
+	for i, e := range d.events {
+		y := rows[i]
+
+		if e.isNote {
+			w := estimateTextWidth(e.text) + 16
+			var left float64
+			switch e.notePos {
+			case "left of":
+				left = x[e.from] - 8 - w
+			case "right of":
+				left = x[e.from] + 8
+			default:
+				a, b := min(x[e.from], x[e.to]), max(x[e.from], x[e.to])
+				w = max(w, b-a+colWidth/2)
+				left = (a+b)/2 - w/2
+			}
+			fmt.Fprintf(&ret,
+				"<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"#ffc\" stroke=\"#996\"></rect>",
+				formatSVGNumber(left), formatSVGNumber(y-14), formatSVGNumber(w), formatSVGNumber(28),
+			)
+			ret.WriteString(svgText(left+w/2, y, e.text))
+			continue
+		}
+
+		attr := " stroke=\"#333\" fill=\"none\""
+		if e.dashed {
+			attr += " stroke-dasharray=\"4 4\""
+		}
+		switch e.arrow {
+		case sequenceArrowFilled:
+			attr += " marker-end=\"url(#" + prefix + "-arrow)\""
+		case sequenceArrowCross:
+			attr += " marker-end=\"url(#" + prefix + "-cross)\""
+		case sequenceArrowOpen:
+			attr += " marker-end=\"url(#" + prefix + "-open)\""
+		}
+
+		if e.from == e.to {
+			x1 := x[e.from]
+			fmt.Fprintf(&ret,
+				"<path d=\"M %s %s h 32 v 16 h -32\"%s></path>",
+				formatSVGNumber(x1), formatSVGNumber(y-16), attr,
+			)
+			fmt.Fprintf(&ret,
+				"<text x=\"%s\" y=\"%s\" dominant-baseline=\"central\">%s</text>",
+				formatSVGNumber(x1+40), formatSVGNumber(y-8), html.EscapeString(e.text),
+			)
+			continue
+		}
+
+		x1, x2 := x[e.from], x[e.to]
+		fmt.Fprintf(&ret,
+			"<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"%s></line>",
+			formatSVGNumber(x1), formatSVGNumber(y), formatSVGNumber(x2), formatSVGNumber(y), attr,
+		)
+		ret.WriteString(svgText((x1+x2)/2, y-12, e.text))
+	}
+
+	ret.WriteString("</svg>")
+	return ret.String()
+}
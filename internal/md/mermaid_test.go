@@ -0,0 +1,92 @@
+package md
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestParseFlowchart(t *testing.T) {
+	got, err := parseFlowchart("LR", []string{
+		"A[開始] --> B{OK?}",
+		"B -->|Yes| C((done)); B -- No --> A",
+		"C -.- D(round) ==> E",
+		"classDef foo fill:#f00",
+	})
+	test.AssertSame(t, err, nil)
+	expect := &flowchart{
+		direction: "LR",
+		nodes: []flowchartNode{
+			{id: "A", label: "開始", shape: flowchartShapeRect},
+			{id: "B", label: "OK?", shape: flowchartShapeDiamond},
+			{id: "C", label: "done", shape: flowchartShapeCircle},
+			{id: "D", label: "round", shape: flowchartShapeRound},
+			{id: "E", label: "E", shape: flowchartShapeRect},
+		},
+		edges: []flowchartEdge{
+			{from: "A", to: "B", arrow: true},
+			{from: "B", to: "C", label: "Yes", arrow: true},
+			{from: "B", to: "A", label: "No", arrow: true},
+			{from: "C", to: "D", style: flowchartEdgeStyleDotted},
+			{from: "D", to: "E", arrow: true, style: flowchartEdgeStyleThick},
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
+	// 閉路があっても階層を決められる
+	test.AssertEquals(t, flowchartRanks(got), map[string]int{"B": 1, "C": 2, "D": 3, "E": 4})
+
+	_, err = parseFlowchart("TD", []string{"subgraph one"})
+	test.AssertSame(t, err != nil, true)
+	_, err = parseFlowchart("TD", []string{"A -> B"})
+	test.AssertSame(t, err != nil, true)
+	_, err = parseFlowchart("XX", []string{"A --> B"})
+	test.AssertSame(t, err != nil, true)
+}
+
+func TestParseSequenceDiagram(t *testing.T) {
+	got, err := parseSequenceDiagram([]string{
+		"participant A as Alice",
+		"A->>+B: Hello",
+		"B-->>A: Hi",
+		"A-x B: bye",
+		"activate A",
+		"Note over A,B: note",
+	})
+	test.AssertSame(t, err, nil)
+	expect := &sequenceDiagram{
+		participants: []sequenceParticipant{
+			{id: "A", label: "Alice"},
+			{id: "B", label: "B"},
+		},
+		events: []sequenceEvent{
+			{from: "A", to: "B", text: "Hello", arrow: sequenceArrowFilled},
+			{from: "B", to: "A", text: "Hi", arrow: sequenceArrowFilled, dashed: true},
+			{from: "A", to: "B", text: "bye", arrow: sequenceArrowCross},
+			{from: "A", to: "B", text: "note", isNote: true, notePos: "over"},
+		},
+	}
+	test.AssertEquals(t, got, expect)
+
+	_, err = parseSequenceDiagram([]string{"loop every minute"})
+	test.AssertSame(t, err != nil, true)
+}
+
+func TestRenderMermaid(t *testing.T) {
+	svg, err := renderMermaid("graph TD\nA --> B")
+	test.AssertSame(t, err, nil)
+	test.AssertSame(t, strings.HasPrefix(svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" class=\"diagram-flowchart\""), true)
+	test.AssertSame(t, strings.HasSuffix(svg, "</svg>"), true)
+
+	_, err = renderMermaid("pie\n\"a\": 1")
+	test.AssertSame(t, err, errMermaidUnknownDiagram)
+
+	// 解釈できない図は、通常のコードブロックとして出力する
+	test.AssertSame(
+		t,
+		ToHTML("```mermaid\npie\n```"),
+		"<pre><code class=\"language-mermaid\">pie</code></pre>",
+	)
+	test.AssertSame(t, strings.HasPrefix(ToHTML("```mermaid\nsequenceDiagram\nA->>B: hi\n```"), "<figure class=\"diagram\"><svg"), true)
+}
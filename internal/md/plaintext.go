@@ -0,0 +1,77 @@
+package md
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 記法を取り除いた本文を返す。ブロック要素ごとに改行で区切る。
+// コードブロック、数式、:::details の中身、画像、脚注の定義は本文ではないので含めない。
+func PlainText(md string) string {
+	return plainText(parseBlock(md))
+}
+
+// PlainText と同じものを、パース済みの文書から求める
+func (d *Document) PlainText() string {
+	return plainText(d.elements)
+}
+
+func plainText(elements []blockElement) string {
+	var lines []string
+	appendPlainTextLines(&lines, elements)
+	return strings.Join(lines, "\n")
+}
+
+// 本文の先頭から、空白をまとめた n 文字 (ルーン) 以内の抜粋を返す。
+// 切り詰めたときは、末尾の … を含めて n 文字にする。
+func Excerpt(md string, n int) string {
+	return excerpt(PlainText(md), n)
+}
+
+// Excerpt と同じものを、パース済みの文書から求める
+func (d *Document) Excerpt(n int) string {
+	return excerpt(d.PlainText(), n)
+}
+
+func excerpt(text string, n int) string {
+	s := strings.Join(strings.Fields(text), " ")
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	r := []rune(s)[:n-1]
+	return strings.TrimRight(string(r), " ") + "…"
+}
+
+func appendPlainTextLines(lines *[]string, elements []blockElement) {
+	for _, e := range elements {
+		switch e.kind {
+		case blockElementKindParagraph:
+			for _, l := range e.children.children {
+				*lines = append(*lines, inlineElementToText(l))
+			}
+		case blockElementKindList,
+			blockElementKindHeading1, blockElementKindHeading2, blockElementKindHeading3,
+			blockElementKindHeading4, blockElementKindHeading5, blockElementKindHeading6:
+			*lines = append(*lines, inlineElementToText(e.children))
+		case blockElementKindTable:
+			for _, row := range append([][]inlineElement{e.tableHeader}, e.tableRows...) {
+				var cells []string
+				for _, c := range row {
+					cells = append(cells, inlineElementToText(c))
+				}
+				*lines = append(*lines, strings.Join(cells, " "))
+			}
+		case blockElementKindCallout:
+			if e.calloutTitle != "" {
+				*lines = append(*lines, e.calloutTitle)
+			}
+			appendPlainTextLines(lines, e.blocks)
+		case blockElementKindBlockquote:
+			appendPlainTextLines(lines, e.blocks)
+		}
+	}
+}
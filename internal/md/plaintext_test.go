@@ -0,0 +1,43 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestPlainText(t *testing.T) {
+	got := PlainText(`# 見出し
+
+**強調** と [リンク](https://example.com) と ` + "`code`" + ` と {漢字|かんじ}[^1]
+- リスト
+
+` + "```go" + `
+func main() {}
+` + "```" + `
+
+:::details 詳細
+隠れた本文
+:::
+
+:::note メモ
+> 引用
+:::
+
+| a | b |
+|---|---|
+| 1 | 2 |
+
+![画像](https://example.com/a.png)
+
+[^1]: 脚注`)
+	test.AssertSame(t, got, "見出し\n強調 と リンク と code と 漢字\nリスト\nメモ\n引用\na b\n1 2")
+}
+
+func TestExcerpt(t *testing.T) {
+	test.AssertSame(t, Excerpt("# タイトル\n\n本文です", 100), "タイトル 本文です")
+	test.AssertSame(t, Excerpt("あいうえおかきくけこ", 5), "あいうえ…")
+	test.AssertSame(t, Excerpt("あいう えお", 6), "あいう えお")
+	test.AssertSame(t, Excerpt("ab cd ef", 4), "ab…")
+	test.AssertSame(t, Excerpt("あいう", 0), "")
+}
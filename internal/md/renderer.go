@@ -0,0 +1,42 @@
+package md
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// MarkdownRenderer が、Document を Parse し直して同じ Document になる Markdown で書き表せないときのエラー
+var ErrNotRepresentable = errors.New("document cannot be represented in markdown")
+
+// Document を別の形式で出力する
+type Renderer interface {
+	Render(w io.Writer, d *Document) error
+}
+
+// ToHTMLWithOptions と同じ HTML を出力する Renderer。
+// Document は通常のパーサーで作られるので、Options.CommonMark は使わない
+type HTMLRenderer struct {
+	Options Options
+}
+
+func (r HTMLRenderer) Render(w io.Writer, d *Document) error {
+	bw := bufio.NewWriter(w)
+	writeDocumentHTML(&htmlWriter{StringWriter: bw, options: r.Options}, nodesToBlockElements(d.Children))
+	return bw.Flush()
+}
+
+// Document を Markdown として出力する Renderer。
+// Parse した Document をそのまま出力すると、Parse し直したときに同じ Document になる。
+// 書き換えた Document が Markdown で書き表せないとき (https:// 以外の画像など) は、
+// 何も出力せずに ErrNotRepresentable を返す。
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Render(w io.Writer, d *Document) error {
+	s, ok := blockElementsToMarkdown(nodesToBlockElements(d.Children))
+	if !ok {
+		return ErrNotRepresentable
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,274 @@
+package md
+
+import (
+	"html"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 出力を許可する HTML のタグと、タグごとに許可する属性。これ以外のタグは取り除き、中身だけを残す
+var (
+	// 段落などの中で使えるタグ
+	inlineHTMLTags = map[string][]string{
+		"a":      {"href"},
+		"abbr":   nil,
+		"b":      nil,
+		"bdi":    nil,
+		"bdo":    {"dir"},
+		"br":     nil,
+		"cite":   nil,
+		"code":   nil,
+		"del":    {"datetime"},
+		"dfn":    nil,
+		"em":     nil,
+		"i":      nil,
+		"img":    {"src", "alt", "width", "height"},
+		"ins":    {"datetime"},
+		"kbd":    nil,
+		"mark":   nil,
+		"q":      nil,
+		"rp":     nil,
+		"rt":     nil,
+		"ruby":   nil,
+		"s":      nil,
+		"samp":   nil,
+		"small":  nil,
+		"span":   nil,
+		"strong": nil,
+		"sub":    nil,
+		"sup":    nil,
+		"time":   {"datetime"},
+		"u":      nil,
+		"var":    nil,
+		"wbr":    nil,
+	}
+	// 行頭にあるとき、その行を HTML のブロックとして扱うタグ
+	blockHTMLTags = map[string][]string{
+		"blockquote": nil,
+		"caption":    nil,
+		"dd":         nil,
+		"details":    {"open"},
+		"div":        nil,
+		"dl":         nil,
+		"dt":         nil,
+		"figcaption": nil,
+		"figure":     nil,
+		"hr":         nil,
+		"li":         nil,
+		"ol":         {"start"},
+		"p":          nil,
+		"summary":    nil,
+		"table":      nil,
+		"tbody":      nil,
+		"td":         {"colspan", "rowspan"},
+		"tfoot":      nil,
+		"th":         {"colspan", "rowspan"},
+		"thead":      nil,
+		"tr":         nil,
+		"ul":         nil,
+	}
+	// すべてのタグで許可する属性
+	globalHTMLAttributes = []string{"title", "lang"}
+	// 値が URL の属性。isSafeURL を満たさなければ取り除く
+	urlHTMLAttributes = []string{"href", "src"}
+	// 閉じタグを持たないタグ
+	voidHTMLTags = []string{"br", "hr", "img", "wbr"}
+	// 中身も含めて取り除くタグ
+	rawTextHTMLTags = []string{"script", "style"}
+)
+
+var (
+	htmlTagNamePattern   = regexp.MustCompile(`^</?(` + cmTagName + `)`)
+	htmlAttributePattern = regexp.MustCompile(`\s+(` + cmAttributeName + `)(?:\s*=\s*(` + cmAttributeValue + `))?`)
+	// 段落などの中で、許可されたタグとして解釈する文字列
+	inlineHTMLPattern = regexp.MustCompile(`^(?:` + cmOpenTag + `|` + cmCloseTag + `)`)
+	// HTML のブロックの開始行
+	blockHTMLPattern = regexp.MustCompile(`(?i)^</?(?:` + strings.Join(sortedKeys(blockHTMLTags), "|") + `)(?:\s|/?>|$).*`)
+)
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 許可されたタグと属性だけを出力する。閉じタグは、対応するタグが開いているときだけ出力する
+type htmlSanitizer struct {
+	// 開いているタグの名前と、名前ごとの数
+	open  []string
+	depth map[string]int
+}
+
+// タグ以外の部分は文字列としてエスケープする。ただし、文字参照はそのまま残す
+func (z *htmlSanitizer) write(w io.StringWriter, s string) {
+	var tags cmHTMLTagMatcher
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			writeSanitizedText(w, s)
+			return
+		}
+		writeSanitizedText(w, s[:i])
+		s = s[i:]
+
+		m := tags.match(s)
+		if m == "" {
+			w.WriteString("&lt;")
+			s = s[1:]
+			continue
+		}
+		s = s[len(m):]
+
+		name := htmlTagNamePattern.FindStringSubmatch(m)
+		if name == nil {
+			// コメントや処理命令などは出力しない
+			continue
+		}
+		tag := strings.ToLower(name[1])
+		if m[1] == '/' {
+			z.closeTag(w, tag)
+			continue
+		}
+		if slices.Contains(rawTextHTMLTags, tag) {
+			// 閉じタグの直前まで読み飛ばす。閉じタグは許可されていないので、次の繰り返しで取り除かれる
+			if j := indexFold(s, "</"+tag); j >= 0 {
+				s = s[j:]
+			} else {
+				s = ""
+			}
+			continue
+		}
+		z.openTag(w, tag, m[len(name[0]):])
+	}
+}
+
+func (z *htmlSanitizer) openTag(w io.StringWriter, tag, attrs string) {
+	allowed, ok := inlineHTMLTags[tag]
+	if !ok {
+		if allowed, ok = blockHTMLTags[tag]; !ok {
+			return
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + tag)
+	for _, a := range htmlAttributePattern.FindAllStringSubmatch(attrs, -1) {
+		key := strings.ToLower(a[1])
+		if !slices.Contains(allowed, key) && !slices.Contains(globalHTMLAttributes, key) {
+			continue
+		}
+		value := a[2]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			value = value[1 : len(value)-1]
+		}
+		value = html.UnescapeString(value)
+		if slices.Contains(urlHTMLAttributes, key) && !isSafeURL(value) {
+			continue
+		}
+		b.WriteString(" " + key + "=\"" + html.EscapeString(value) + "\"")
+	}
+	b.WriteString(">")
+	w.WriteString(b.String())
+
+	if !slices.Contains(voidHTMLTags, tag) {
+		if z.depth == nil {
+			z.depth = make(map[string]int)
+		}
+		z.open = append(z.open, tag)
+		z.depth[tag]++
+	}
+}
+
+// tag が開いていれば、その内側で開いているタグとともに閉じる
+func (z *htmlSanitizer) closeTag(w io.StringWriter, tag string) {
+	if z.depth[tag] == 0 {
+		return
+	}
+	for {
+		last := z.pop(w)
+		if last == tag {
+			return
+		}
+	}
+}
+
+// 開いているすべてのタグを閉じる
+func (z *htmlSanitizer) close(w io.StringWriter) {
+	for len(z.open) > 0 {
+		z.pop(w)
+	}
+}
+
+func (z *htmlSanitizer) pop(w io.StringWriter) string {
+	tag := z.open[len(z.open)-1]
+	w.WriteString("</" + tag + ">")
+	z.open = z.open[:len(z.open)-1]
+	z.depth[tag]--
+	return tag
+}
+
+func writeSanitizedText(w io.StringWriter, s string) {
+	for s != "" {
+		i := strings.IndexAny(s, "&<>\"")
+		if i < 0 {
+			w.WriteString(s)
+			return
+		}
+		w.WriteString(s[:i])
+		s = s[i:]
+		switch s[0] {
+		case '&':
+			if m := cmEntityPattern.FindString(s); m != "" {
+				w.WriteString(m)
+				s = s[len(m):]
+				continue
+			}
+			w.WriteString("&amp;")
+		case '<':
+			w.WriteString("&lt;")
+		case '>':
+			w.WriteString("&gt;")
+		case '"':
+			w.WriteString("&quot;")
+		}
+		s = s[1:]
+	}
+}
+
+// ASCII の大文字と小文字を区別せずに substr を探す
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// リンクなどの URL として出力してよいか。スキームが無い相対 URL と、http, https, mailto だけを許可する
+func isSafeURL(u string) bool {
+	// ブラウザは URL の前後の制御文字と空白、途中のタブと改行を無視する
+	u = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, u)
+	u = strings.TrimLeft(u, "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x0b\x0c\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f ")
+
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(u[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
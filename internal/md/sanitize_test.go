@@ -0,0 +1,162 @@
+package md
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+// HTML を、許可されたタグと属性だけにする。閉じられていないタグは末尾で閉じる
+func sanitizeHTML(s string) string {
+	var b strings.Builder
+	var z htmlSanitizer
+	z.write(&b, s)
+	z.close(&b)
+	return b.String()
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		input, expect string
+	}{
+		{"<kbd>Ctrl</kbd>", "<kbd>Ctrl</kbd>"},
+		{"<ABBR Title='a &amp; b'>ab</ABBR>", "<abbr title=\"a &amp; b\">ab</abbr>"},
+		{"a<br/>b<hr>", "a<br>b<hr>"},
+		{"<span onclick=\"alert(1)\" style=\"x\">a</span>", "<span>a</span>"},
+		{"<a href=\"javascript:alert(1)\">a</a>", "<a>a</a>"},
+		{"<a href=\"JaVa&#x09;Script&colon;alert(1)\">a</a>", "<a>a</a>"},
+		{"<a href=\"/a?b=c\" title=\"t\">a</a>", "<a href=\"/a?b=c\" title=\"t\">a</a>"},
+		{"<img src=x onerror=alert(1)>", "<img src=\"x\">"},
+		{"<script>alert(1)</script>a", "a"},
+		{"<STYLE>*{}</Style>a", "a"},
+		{"<iframe src=\"https://example.com\"></iframe>a", "a"},
+		{"<!-- a -->b<![CDATA[c]]>", "b"},
+		{"<b><i>a</b>b</i>", "<b><i>a</i></b>b"},
+		{"<div><p>a", "<div><p>a</p></div>"},
+		{"a < b && c > d &amp; &#60;", "a &lt; b &amp;&amp; c &gt; d &amp; &#60;"},
+		{"<a title=\"x\"onclick=\"y\">", "&lt;a title=&quot;x&quot;onclick=&quot;y&quot;&gt;"},
+	}
+	for _, tt := range tests {
+		test.AssertEquals(t, sanitizeHTML(tt.input), tt.expect)
+	}
+}
+
+func TestHTMLInMarkdown(t *testing.T) {
+	test.AssertEquals(t, ToHTML("Press <kbd>Ctrl</kbd> + <kbd>C</kbd>"), "<p>Press <kbd>Ctrl</kbd> + <kbd>C</kbd></p>")
+	test.AssertEquals(t, ToHTML("H<sub>2</sub>O, x<sup>**2**</sup>"), "<p>H<sub>2</sub>O, x<sup><b>2</b></sup></p>")
+	// 許可されていないタグは、これまでどおり文字列として出力する
+	test.AssertEquals(t, ToHTML("<script>alert(1)</script> <b onclick=\"x\">a"), "<p>&lt;script&gt;alert(1)&lt;/script&gt; <b>a</b></p>")
+	test.AssertEquals(t, ToHTML("`<kbd>`"), "<p><code>&lt;kbd&gt;</code></p>")
+	// ブロックのタグは、閉じタグまでの間を Markdown として解釈する
+	test.AssertEquals(t, ToHTML("<div title=\"a\">\n\n- b\n\n</div>\n</div>"), "<div title=\"a\"><ul><li>b</li></ul></div>")
+	test.AssertEquals(t, ToHTML("> <div>\n> a"), "<blockquote><div><p>a</p></div></blockquote>")
+	test.AssertEquals(t, ToHTML("<details open>\n<summary>a</summary>\n\nb\n</details>"), "<details open=\"\"><summary>a</summary><p>b</p></details>")
+}
+
+var (
+	// sanitizeHTML が出力するタグ。属性の値は常に " で囲まれる
+	sanitizedTagPattern = regexp.MustCompile(`^<(/?)([a-z0-9]+)((?: [a-z]+="[^"<>]*")*)>`)
+	// ToHTML が出力するタグ
+	outputTagPattern       = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'<>/=]+(?:="[^"]*"|='[^']*')?)*)\s*/?>`)
+	outputAttributePattern = regexp.MustCompile(`([^\s"'<>/=]+)(?:="([^"]*)"|='([^']*)')?`)
+)
+
+// スクリプトを実行できるタグ、属性、URL が無いことを確かめる
+func assertNoScript(t *testing.T, input, s string) {
+	t.Helper()
+	for i := strings.IndexByte(s, '<'); i >= 0; i = nextIndexByte(s, '<', i) {
+		m := outputTagPattern.FindStringSubmatch(s[i:])
+		if m == nil {
+			t.Fatalf("unescaped '<' at %d\ninput:  %q\noutput: %q", i, input, s)
+		}
+		switch strings.ToLower(m[1]) {
+		case "script", "style", "iframe", "frame", "object", "embed", "base", "form", "meta", "link", "template":
+			t.Fatalf("disallowed tag %q\ninput:  %q\noutput: %q", m[0], input, s)
+		}
+		for _, a := range outputAttributePattern.FindAllStringSubmatch(m[2], -1) {
+			key := strings.ToLower(a[1])
+			value := strings.ToLower(html.UnescapeString(a[2] + a[3]))
+			value = strings.Map(func(r rune) rune {
+				if r <= ' ' {
+					return -1
+				}
+				return r
+			}, value)
+			if strings.HasPrefix(key, "on") || strings.HasPrefix(value, "javascript:") ||
+				strings.HasPrefix(value, "vbscript:") || strings.HasPrefix(value, "data:") {
+				t.Fatalf("disallowed attribute %q\ninput:  %q\noutput: %q", a[0], input, s)
+			}
+		}
+	}
+}
+
+func nextIndexByte(s string, c byte, i int) int {
+	j := strings.IndexByte(s[i+1:], c)
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+var xssSeeds = []string{
+	"<script>alert(1)</script>",
+	"<img src=x onerror=alert(1)>",
+	"<a href=\"javascript:alert(1)\">a</a>",
+	"<a href=\"&#106;avascript:alert(1)\">a</a>",
+	"<a href=\" \x01java\tscript:alert(1)\">a</a>",
+	"<a href='data:text/html,<script>alert(1)</script>'>a</a>",
+	"<svg><script>alert(1)</script></svg>",
+	"<scr<script>ipt>alert(1)</script>",
+	"<div title=\"\"><script>alert(1)</script>\">",
+	"<kbd title=\"a\" onmouseover=\"alert(1)\">a</kbd>",
+	"<!--<script>-->alert(1)",
+	"<style>@import 'x'</style>",
+	"[a](javascript:alert(1))",
+	"![a](javascript:alert(1))",
+	"<javascript:alert(1)>",
+}
+
+func FuzzSanitizeHTML(f *testing.F) {
+	for _, s := range xssSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		out := sanitizeHTML(s)
+		assertNoScript(t, s, out)
+
+		// 許可されたタグと属性だけが、決まった形で出力される
+		for i := strings.IndexByte(out, '<'); i >= 0; i = nextIndexByte(out, '<', i) {
+			m := sanitizedTagPattern.FindStringSubmatch(out[i:])
+			if m == nil {
+				t.Fatalf("unexpected tag at %d\ninput:  %q\noutput: %q", i, s, out)
+			}
+			allowed, ok := inlineHTMLTags[m[2]]
+			if !ok {
+				allowed, ok = blockHTMLTags[m[2]]
+			}
+			if !ok {
+				t.Fatalf("disallowed tag %q\ninput:  %q\noutput: %q", m[0], s, out)
+			}
+			for _, a := range outputAttributePattern.FindAllStringSubmatch(m[3], -1) {
+				if !slices.Contains(allowed, a[1]) && !slices.Contains(globalHTMLAttributes, a[1]) {
+					t.Fatalf("disallowed attribute %q\ninput:  %q\noutput: %q", a[0], s, out)
+				}
+			}
+		}
+	})
+}
+
+func FuzzToHTML(f *testing.F) {
+	for _, s := range xssSeeds {
+		f.Add(s)
+	}
+	f.Add("<div>\n\n<kbd>a</kbd> **b** [c](https://example.com)\n\n</div>")
+	f.Fuzz(func(t *testing.T, s string) {
+		assertNoScript(t, s, ToHTML(s))
+		assertNoScript(t, s, ToHTMLWithOptions(s, Options{CommonMark: true}))
+	})
+}
@@ -0,0 +1,27 @@
+package md
+
+// 元の文書の行ごとに、その行を含む最も内側のブロック要素の開始行を返す。
+// 返り値の i 番目が i+1 行目に対応し、空行などの対応するブロック要素が無い行は 0 になる。
+// 開始行は、Options.SourceLine を設定したときの data-source-line 属性の値と一致する。
+func SourceLineMap(md string) []int {
+	return parseDocument(md).SourceLineMap()
+}
+
+// SourceLineMap と同じものを、パース済みの文書から求める
+func (d *Document) SourceLineMap() []int {
+	ret := make([]int, len(d.lines))
+
+	// 外側の要素から順に訪問するので、内側の要素で上書きされる
+	walkBlockElements(d.elements, func(e *blockElement) {
+		switch e.kind {
+		case blockElementKindEmpty, blockElementKindFootnoteDefinition, blockElementKindHTML:
+			// HTML では属性が出力されない
+			return
+		}
+		for l := e.line; l <= e.endLine && l <= len(ret); l++ {
+			ret[l-1] = e.line
+		}
+	})
+
+	return ret
+}
@@ -0,0 +1,50 @@
+package md
+
+import (
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestToHTMLWithSourceLine(t *testing.T) {
+	got := ToHTMLWithOptions(`# title
+text
+text
+
+- a
+- [x] b
+
+:::note
+> quote
+:::
+`+"```go:main.go"+`
+x
+`+"```", Options{SourceLine: true})
+	expect := "<h1 id=\"title\" data-source-line=\"1\">title</h1>" +
+		"<p data-source-line=\"2\">texttext</p>" +
+		"<ul><li data-source-line=\"5\">a</li><li data-source-line=\"6\"><input type='checkbox' checked inert>b</li></ul>" +
+		"<aside class=\"callout callout-note\" data-source-line=\"8\"><blockquote data-source-line=\"9\"><p data-source-line=\"9\">quote</p></blockquote></aside>" +
+		"<figure class=\"code-block\" data-source-line=\"11\"><figcaption>main.go</figcaption><pre><code class=\"language-go\">x</code></pre></figure>"
+	test.AssertSame(t, got, expect)
+
+	// 既定では出力しない
+	test.AssertSame(t, ToHTML("text"), "<p>text</p>")
+}
+
+func TestSourceLineMap(t *testing.T) {
+	s := `text
+text
+
+:::details
+- a
+- b
+:::
+[^1]: note`
+	test.AssertEquals(t, SourceLineMap(s), []int{1, 1, 0, 4, 5, 6, 4, 0})
+
+	d, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEquals(t, d.SourceLineMap(), []int{1, 1, 0, 4, 5, 6, 4, 0})
+}
@@ -0,0 +1,80 @@
+package md
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 日本語の文章を 1 分間に読む文字数
+const readingCharactersPerMinute = 500
+
+// 文書の統計
+type Statistics struct {
+	// PlainText の文字数 (ルーン単位)。空白は数えない
+	Characters int
+	CodeBlocks int
+	// コードブロックの行数の合計
+	CodeLines int
+	Images    int
+	Links     int
+	// Characters を読むのにかかる時間 (分、切り上げ)
+	ReadingMinutes int
+}
+
+// 文書の統計を求める。文字数は、PlainText と同じ本文を数える
+func Stats(md string) Statistics {
+	return stats(parseBlock(md))
+}
+
+// Stats と同じものを、パース済みの文書から求める
+func (d *Document) Stats() Statistics {
+	return stats(d.elements)
+}
+
+func stats(elements []blockElement) Statistics {
+	s := Statistics{Characters: countCharacters(plainText(elements))}
+
+	walkBlockElements(elements, func(e *blockElement) {
+		switch e.kind {
+		case blockElementKindCodeBlock:
+			s.CodeBlocks++
+			if e.codeText != "" {
+				s.CodeLines += strings.Count(e.codeText, "\n") + 1
+			}
+		case blockElementKindImage:
+			s.Images++
+		}
+
+		countLinks(&s, e.children)
+		for _, c := range e.tableHeader {
+			countLinks(&s, c)
+		}
+		for _, row := range e.tableRows {
+			for _, c := range row {
+				countLinks(&s, c)
+			}
+		}
+	})
+
+	s.ReadingMinutes = (s.Characters + readingCharactersPerMinute - 1) / readingCharactersPerMinute
+	return s
+}
+
+func countLinks(s *Statistics, e inlineElement) {
+	if e.kind == inlineElementKindLink {
+		s.Links++
+	}
+	for _, c := range e.children {
+		countLinks(s, c)
+	}
+}
+
+func countCharacters(str string) int {
+	n := 0
+	for _, r := range str {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,40 @@
+package md
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/comame/note.comame.xyz/internal/test"
+)
+
+func TestStats(t *testing.T) {
+	got := Stats(`# 見出し
+
+**本文** と [リンク](https://example.com) と <https://example.com> と ` + "`code`" + ` と $x$ と {漢字|かんじ}
+
+` + "```go" + `
+package main
+
+func main() {}
+` + "```" + `
+
+![画像](https://example.com/a.png)
+
+| a | b |
+|---|---|`)
+	test.AssertEquals(t, got, Statistics{
+		// 見出し(3) + 本文とリンクと(7) + https://example.com(19) + とcodeとと漢字(9) + ab(2)
+		Characters:     40,
+		CodeBlocks:     1,
+		CodeLines:      3,
+		Images:         1,
+		Links:          2,
+		ReadingMinutes: 1,
+	})
+
+	// PlainText に含まれない :::details と脚注の中身は数えない
+	test.AssertEquals(t, Stats(":::details 詳細\n隠れた本文\n:::\n\n本文[^1]\n\n[^1]: 脚注").Characters, 2)
+
+	test.AssertEquals(t, Stats(strings.Repeat("あ", 1001)).ReadingMinutes, 3)
+	test.AssertEquals(t, Stats("").ReadingMinutes, 0)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/comame/note.comame.xyz/internal/md"
+)
+
+// 全ての記事の本文を md.Format で整形する。
+// 整形で本文が変わった記事のみ、元の本文を nt_post_log に残してから更新する。
+// 記事の内容の更新ではないので、更新日時は変えない。
+func FormatPosts(ctx context.Context) error {
+	con, err := GetConnection()
+	if err != nil {
+		return err
+	}
+
+	posts, err := con.getPosts(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		formatted, err := md.Format(p.Text)
+		var formatErr *md.FormatError
+		if errors.As(err, &formatErr) {
+			// 整形できなかった部分は元の書き方のまま残っているので、残りを整形した本文で更新する
+			log.Printf("post %d: %v", p.ID, err)
+		} else if err != nil {
+			log.Printf("skip post %d: %v", p.ID, err)
+			continue
+		}
+		if formatted == p.Text {
+			continue
+		}
+
+		p.Text = formatted
+		if err := formatPostInTransaction(ctx, con, p); err != nil {
+			return err
+		}
+		log.Printf("formatted post %d", p.ID)
+	}
+
+	return nil
+}
+
+func formatPostInTransaction(ctx context.Context, con *connection, p post) error {
+	if err := con.Begin(ctx); err != nil {
+		return err
+	}
+	defer con.Rollback()
+
+	if err := con.copyPostToPostLogInTransaction(ctx, p.ID); err != nil {
+		return err
+	}
+	if err := con.updatePostInTransaction(ctx, p); err != nil {
+		return err
+	}
+
+	return con.Commit()
+}
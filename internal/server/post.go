@@ -4,8 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-
-	"github.com/comame/note.comame.xyz/internal/md"
 )
 
 type post struct {
@@ -16,7 +14,6 @@ type post struct {
 	Title           string         `json:"title"`
 	Text            string         `json:"text"`
 	Visibility      postVisibility `json:"visibility"`
-	HTML            string         `json:"-"`
 }
 
 type postVisibility int
@@ -83,8 +80,6 @@ func getPost(ctx context.Context, urlKey string, visibility postVisibility) (*po
 		return nil, errNotFound
 	}
 
-	p.HTML = md.ToHTML(p.Text)
-
 	return p, nil
 }
 
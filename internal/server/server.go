@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/comame/note.comame.xyz/internal/md"
 	"github.com/comame/note.comame.xyz/internal/oidc"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -115,13 +116,18 @@ func Start() {
 			return
 		}
 
+		warnings, ok := lintPostText(w, p1.Text)
+		if !ok {
+			return
+		}
+
 		p2, err := createPost(r.Context(), p1)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		j, _ := json.Marshal(redirectResponse{Location: p2.getURL()})
+		j, _ := json.Marshal(redirectResponse{Location: p2.getURL(), Warnings: warnings})
 		w.Write(j)
 	})
 
@@ -221,6 +227,11 @@ func Start() {
 			return
 		}
 
+		warnings, ok := lintPostText(w, p.Text)
+		if !ok {
+			return
+		}
+
 		p2, err := updatePost(r.Context(), p)
 		if err != nil {
 			log.Println(err)
@@ -228,7 +239,7 @@ func Start() {
 			return
 		}
 
-		j, _ := json.Marshal(redirectResponse{Location: p2.getURL()})
+		j, _ := json.Marshal(redirectResponse{Location: p2.getURL(), Warnings: warnings})
 		w.Write(j)
 	})
 
@@ -360,6 +371,28 @@ func Start() {
 
 type redirectResponse struct {
 	Location string `json:"location"`
+	// 保存はしたが、記法に誤りがありそうな箇所
+	Warnings []md.Diagnostic `json:"warnings,omitempty"`
+}
+
+type lintErrorResponse struct {
+	Diagnostics []md.Diagnostic `json:"diagnostics"`
+}
+
+// 本文にエラーがあれば 400 を返し、ok を false にする。警告だけであれば、それを返す
+func lintPostText(w http.ResponseWriter, text string) (warnings []md.Diagnostic, ok bool) {
+	diagnostics := md.Lint(text)
+
+	for _, d := range diagnostics {
+		if d.Severity == md.SeverityError {
+			j, _ := json.Marshal(lintErrorResponse{Diagnostics: diagnostics})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(j)
+			return nil, false
+		}
+	}
+
+	return diagnostics, true
 }
 
 func postPage(w http.ResponseWriter, r *http.Request, s *session) {
@@ -390,5 +423,17 @@ func postPage(w http.ResponseWriter, r *http.Request, s *session) {
 		return
 	}
 
-	renderTemplate(s, w, "post", p.Title+" | note.comame.xyz", templatePost{Post: *p, EditLink: fmt.Sprintf("/edit/post/%d", p.ID)})
+	doc, err := md.Parse(p.Text)
+	if err != nil {
+		renderInternalServerError(s, w)
+		return
+	}
+
+	var html strings.Builder
+	if err := (md.HTMLRenderer{}).Render(&html, doc); err != nil {
+		renderInternalServerError(s, w)
+		return
+	}
+
+	renderTemplate(s, w, "post", p.Title+" | note.comame.xyz", templatePost{Post: *p, Document: doc, HTML: html.String(), Stats: doc.Stats(), EditLink: fmt.Sprintf("/edit/post/%d", p.ID)})
 }
@@ -2,12 +2,16 @@ package server
 
 import (
 	"bytes"
-	"fmt"
 	"log"
 	"net/http"
 	"text/template"
+
+	"github.com/comame/note.comame.xyz/internal/md"
 )
 
+// og:description と記事一覧に出す、本文の抜粋の文字数
+const excerptLength = 120
+
 type templateName string
 
 const (
@@ -26,8 +30,12 @@ type templateError struct {
 
 type templatePost struct {
 	Post       post
+	Stats      md.Statistics
 	EditLink   string
 	IsLoggedIn bool
+	// 本文を 1 回だけパースして、HTML と統計、og:description の抜粋を求める
+	Document *md.Document
+	HTML     string
 }
 
 type templateEditor struct {
@@ -69,6 +77,9 @@ func setupTemplate() *template.Template {
 		"visibilityLabel": func(p post) string {
 			return p.visibilityLabel()
 		},
+		"excerpt": func(p post) string {
+			return md.Excerpt(p.Text, excerptLength)
+		},
 	})
 	template.Must(t.ParseGlob("templates/*.html"))
 	return t
@@ -93,7 +104,9 @@ func renderTemplate(s *session, w http.ResponseWriter, name templateName, title
 	ogDescription := "note.comame.xyz"
 	if name == templateNamePost {
 		p := param.(templatePost)
-		ogDescription = fmt.Sprintf("%d字", len(p.Post.Text))
+		if e := p.Document.Excerpt(excerptLength); e != "" {
+			ogDescription = e
+		}
 	}
 
 	if err := t.ExecuteTemplate(w, "app.html", templateApp{
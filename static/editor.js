@@ -17,6 +17,9 @@ const tabPreviewLink = document.getElementById("tab-preview");
 const editorMain = document.getElementById("editor-main");
 const editorPreview = document.getElementById("editor-preview");
 const form = document.getElementById("editor-root");
+const diagnosticsList = document.getElementById("diagnostics");
+const statsParagraph = document.getElementById("stats");
+const formatButton = document.getElementById("format");
 const isDemoMeta = document.querySelector("meta[name=is-demo]");
 
 const draft = getDraftForCurrentPage();
@@ -25,14 +28,37 @@ if (draft !== null && window.confirm("下書きを読み込みますか？")) {
   inputDiv.value = draft.text;
 }
 
-outputDiv.innerHTML = go_parseMarkdown(inputDiv.value);
+/** @type {number[]} */
+let sourceLineMap = [];
+
+renderPreview();
 
 inputDiv.addEventListener("input", (e) => {
   e.preventDefault();
 
   const fd = new FormData(form);
   saveDraftForCurrentPage(fd.get("title"), fd.get("input"));
-  outputDiv.innerHTML = go_parseMarkdown(inputDiv.value);
+  renderPreview();
+  syncPreviewScroll();
+});
+
+for (const event of ["click", "keyup"]) {
+  inputDiv.addEventListener(event, () => {
+    syncPreviewScroll();
+  });
+}
+
+// デモのページには保存と整形のボタンが無い
+formatButton?.addEventListener("click", () => {
+  const formatted = go_formatMarkdown(inputDiv.value);
+  if (formatted === inputDiv.value) {
+    return;
+  }
+
+  inputDiv.value = formatted;
+  const fd = new FormData(form);
+  saveDraftForCurrentPage(fd.get("title"), fd.get("input"));
+  renderPreview();
 });
 
 tabEditorLink.addEventListener("click", (e) => {
@@ -69,14 +95,108 @@ form.addEventListener("submit", async (e) => {
   });
 
   if (!res.ok) {
+    // 記法のエラーで保存できなかったときは、その内容を表示する
+    if (res.status === 400) {
+      const js = await res.json().catch(() => null);
+      if (js !== null && js["diagnostics"]) {
+        renderDiagnostics(js["diagnostics"]);
+        window.alert("記法にエラーがあるため保存できません");
+      }
+    }
     return;
   }
 
   const js = await res.json();
+  if (js["warnings"]) {
+    console.warn(js["warnings"]);
+  }
   clearDraftForCurrentPage();
   location.replace(js["location"]);
 });
 
+function renderPreview() {
+  const preview = go_renderPreview(inputDiv.value);
+  outputDiv.innerHTML = preview.html;
+  sourceLineMap = preview.sourceLineMap;
+  renderDiagnostics(preview.diagnostics);
+  renderStats(preview.stats);
+}
+
+/**
+ * @param {{characters: number, codeBlocks: number, codeLines: number, images: number, links: number, readingMinutes: number}} stats
+ */
+function renderStats(stats) {
+  statsParagraph.textContent =
+    `${stats.characters}字・約${stats.readingMinutes}分` +
+    `・コード ${stats.codeBlocks} 個 (${stats.codeLines} 行)` +
+    `・画像 ${stats.images} 枚・リンク ${stats.links} 個`;
+}
+
+/**
+ * @param {{line: number, column: number, severity: string, message: string}[]} diagnostics
+ */
+function renderDiagnostics(diagnostics) {
+  diagnosticsList.replaceChildren();
+
+  for (const d of diagnostics) {
+    const li = document.createElement("li");
+    li.classList.add("severity-" + d.severity);
+    li.textContent = `${d.line}:${d.column} ${d.severity}: ${d.message}`;
+    li.addEventListener("click", () => {
+      moveCursorTo(d.line, d.column);
+    });
+    diagnosticsList.append(li);
+  }
+}
+
+/**
+ * 1 から始まる行と列の位置にカーソルを移動する
+ * @param {number} line
+ * @param {number} column
+ */
+function moveCursorTo(line, column) {
+  const lines = inputDiv.value.split("\n");
+  let offset = 0;
+  for (let i = 0; i < line - 1 && i < lines.length; i++) {
+    offset += lines[i].length + 1;
+  }
+  // 列はコードポイント単位なので、UTF-16 の位置に直す
+  const current = lines[line - 1] ?? "";
+  offset += [...current].slice(0, column - 1).join("").length;
+
+  inputDiv.focus();
+  inputDiv.setSelectionRange(offset, offset);
+  syncPreviewScroll();
+}
+
+/**
+ * カーソルのある行に対応する要素が見えるよう、プレビューをスクロールする
+ */
+function syncPreviewScroll() {
+  const line = inputDiv.value
+    .slice(0, inputDiv.selectionStart)
+    .split("\n").length;
+
+  // 空行などは対応する要素が無いので、直前の行の要素を使う
+  for (let l = line; l >= 1; l--) {
+    const sourceLine = sourceLineMap[l - 1];
+    if (!sourceLine) {
+      continue;
+    }
+
+    const el = outputDiv.querySelector(`[data-source-line="${sourceLine}"]`);
+    if (el === null) {
+      return;
+    }
+
+    const offset =
+      el.getBoundingClientRect().top -
+      editorPreview.getBoundingClientRect().top;
+    editorPreview.scrollTop += offset - 16;
+    return;
+  }
+}
+
 function isDemo() {
   return isDemoMeta.getAttribute("value") === "true";
 }